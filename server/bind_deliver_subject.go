@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/nats-io/nats"
+)
+
+// ErrNoSuchDurableToObserve is returned when a BindDeliverSubject request
+// names a durable that does not exist: there is nothing to observe.
+var ErrNoSuchDurableToObserve = fmt.Errorf("stan: no existing durable found for BindDeliverSubject")
+
+// bindDeliverSubject attaches a plain NATS subscriber to an existing
+// durable's ackInbox purely for observability: no subscription state is
+// created or modified in the store, so this does not race with, steal
+// from, or otherwise disturb the durable's real owner.
+//
+// This is the companion to BindOnly (see durable_group.go): BindOnly lets
+// a client take over a durable's delivery; BindDeliverSubject lets a
+// client (or an operator tool) watch what a durable is already receiving
+// without participating in its ack protocol at all.
+//
+// The returned unbind func releases the republishing subscription; the
+// caller must call it once the watcher disconnects (or the durable it's
+// observing is torn down), or the subscription -- and its republish
+// goroutine -- would otherwise live for the rest of the server's life.
+func (s *StanServer) bindDeliverSubject(existing *subState, watcherInbox string) (deliverSubject string, unbind func() error, err error) {
+	if existing == nil {
+		return "", nil, ErrNoSuchDurableToObserve
+	}
+	existing.RLock()
+	ackInbox := existing.AckInbox
+	existing.RUnlock()
+
+	// Mirror every message published on the durable's ackInbox to the
+	// watcher's inbox. This is a plain NATS subscription + republish: the
+	// watcher never acks, never appears in acksPending, and its presence
+	// or absence has zero effect on redelivery or durable ownership.
+	sub, err := s.ncs.Subscribe(ackInbox, func(m *nats.Msg) {
+		s.ncs.Publish(watcherInbox, m.Data)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return ackInbox, sub.Unsubscribe, nil
+}
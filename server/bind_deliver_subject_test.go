@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+func TestBindDeliverSubjectNoExistingDurable(t *testing.T) {
+	s := &StanServer{}
+	if _, _, err := s.bindDeliverSubject(nil, "watcher.inbox"); err != ErrNoSuchDurableToObserve {
+		t.Fatalf("Expected ErrNoSuchDurableToObserve, got %v", err)
+	}
+}
+
+func TestBindDeliverSubjectMirrorsAndUnbinds(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	ackInbox := nats.NewInbox()
+	watcherInbox := nats.NewInbox()
+	existing := &subState{AckInbox: ackInbox}
+
+	deliverSubject, unbind, err := s.bindDeliverSubject(existing, watcherInbox)
+	if err != nil {
+		t.Fatalf("Unexpected error on bindDeliverSubject: %v", err)
+	}
+	if deliverSubject != ackInbox {
+		t.Fatalf("Expected deliver subject %q, got %q", ackInbox, deliverSubject)
+	}
+	if unbind == nil {
+		t.Fatal("Expected a non-nil unbind func")
+	}
+
+	watched := make(chan *nats.Msg, 1)
+	if _, err := nc.ChanSubscribe(watcherInbox, watched); err != nil {
+		t.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+	nc.Flush()
+
+	if err := nc.Publish(ackInbox, []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error on publish: %v", err)
+	}
+	select {
+	case m := <-watched:
+		if string(m.Data) != "hello" {
+			t.Fatalf("Expected mirrored data %q, got %q", "hello", m.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not receive mirrored message before unbind")
+	}
+
+	// Once unbound, nothing should observe further ackInbox traffic --
+	// proving the subscription (and its republish goroutine) was actually
+	// released rather than leaked for the rest of the server's life.
+	if err := unbind(); err != nil {
+		t.Fatalf("Unexpected error on unbind: %v", err)
+	}
+	nc.Flush()
+
+	if err := nc.Publish(ackInbox, []byte("after-unbind")); err != nil {
+		t.Fatalf("Unexpected error on publish: %v", err)
+	}
+	nc.Flush()
+	select {
+	case m := <-watched:
+		t.Fatalf("Expected no message after unbind, got %q", m.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"time"
+)
+
+// Default values for the server-initiated client heartbeat subsystem.
+// These mirror the connect-time heartbeat handshake used by thrift_nats
+// over NATS: the server pings HeartbeatInbox and expects a reply within
+// ClientHBTimeout; after ClientHBFailCount consecutive misses, the client
+// is considered dead and torn down.
+const (
+	DefaultClientHBInterval  = 30 * time.Second
+	DefaultClientHBTimeout   = 10 * time.Second
+	DefaultClientHBFailCount = 10
+)
+
+// clientHB tracks the liveness state for a single client's heartbeat
+// loop. One is created per client when ClientHBInterval > 0 and stopped
+// when the client is unregistered (by heartbeat failure or by an
+// explicit close).
+type clientHB struct {
+	client *client
+	inbox  string
+	timer  *time.Timer
+	failed int
+	stopCh chan struct{}
+
+	// hb holds this client's negotiated heartbeat settings (see
+	// client_heartbeat_negotiation.go) when it connected with non-default
+	// HBIntervalMs/HBTimeoutMs/MaxFailedHB. nil means the client uses the
+	// server-wide ClientHBInterval/ClientHBTimeout/ClientHBFailCount
+	// options via the plain startClientHeartbeats path.
+	hb *negotiatedHB
+}
+
+// startClientHeartbeats begins the background liveness loop for client c,
+// pinging c's HeartbeatInbox every s.opts.ClientHBInterval. It is a no-op
+// when ClientHBInterval is zero (the feature is opt-out, defaulting to
+// DefaultClientHBInterval).
+func (s *StanServer) startClientHeartbeats(c *client) {
+	interval := s.opts.ClientHBInterval
+	if interval <= 0 {
+		return
+	}
+	hb := &clientHB{
+		client: c,
+		inbox:  c.info.HeartbeatInbox,
+		stopCh: make(chan struct{}),
+	}
+	c.Lock()
+	c.hb = hb
+	c.Unlock()
+
+	hb.timer = time.AfterFunc(interval, func() {
+		s.sendClientHeartbeat(hb)
+	})
+}
+
+// sendClientHeartbeat publishes a PING to the client's heartbeat inbox
+// and waits up to ClientHBTimeout for a PONG reply. A reply resets the
+// failure counter; a timeout increments it, and once it reaches
+// ClientHBFailCount the client is evicted through the same teardown path
+// used for an explicit close.
+func (s *StanServer) sendClientHeartbeat(hb *clientHB) {
+	select {
+	case <-hb.stopCh:
+		return
+	default:
+	}
+
+	timeout := s.opts.ClientHBTimeout
+	if timeout <= 0 {
+		timeout = DefaultClientHBTimeout
+	}
+
+	_, err := s.ncs.Request(hb.inbox, []byte("PING"), timeout)
+	if err == nil {
+		hb.failed = 0
+	} else {
+		hb.failed++
+	}
+
+	failCount := s.opts.ClientHBFailCount
+	if failCount <= 0 {
+		failCount = DefaultClientHBFailCount
+	}
+
+	if hb.failed >= failCount {
+		s.evictDeadClient(hb.client)
+		return
+	}
+
+	interval := s.opts.ClientHBInterval
+	hb.timer.Reset(interval)
+}
+
+// evictDeadClient tears a client down the same way sendCloseResponse
+// does for an explicit close: its subscriptions, durables' ack-pending
+// state, and client record are all removed.
+func (s *StanServer) evictDeadClient(c *client) {
+	c.Lock()
+	failed := 0
+	if c.hb != nil {
+		failed = c.hb.failed
+		close(c.hb.stopCh)
+		if c.hb.timer != nil {
+			c.hb.timer.Stop()
+		}
+	}
+	clientID := c.info.ClientID
+	c.Unlock()
+
+	s.emitClientHeartbeatTimeout(clientID, s.now(), failed)
+	s.closeClient(clientID)
+}
+
+// stopClientHeartbeats cancels the liveness loop for c, if one is
+// running. Called when the client closes cleanly so the background timer
+// doesn't fire against a removed client.
+func (s *StanServer) stopClientHeartbeats(c *client) {
+	c.Lock()
+	hb := c.hb
+	c.hb = nil
+	c.Unlock()
+	if hb == nil {
+		return
+	}
+	close(hb.stopCh)
+	if hb.timer != nil {
+		hb.timer.Stop()
+	}
+}
+
+// clientHBOptionsForResponse fills in the HeartbeatInterval and
+// HeartbeatFailCount fields of a ConnectResponse so that clients can tune
+// their own dead-server detection to match what this server will do.
+func (s *StanServer) clientHBOptionsForResponse() (interval time.Duration, failCount int) {
+	interval = s.opts.ClientHBInterval
+	if interval <= 0 {
+		interval = DefaultClientHBInterval
+	}
+	failCount = s.opts.ClientHBFailCount
+	if failCount <= 0 {
+		failCount = DefaultClientHBFailCount
+	}
+	return interval, failCount
+}
@@ -0,0 +1,138 @@
+package server
+
+import "time"
+
+// Bounds on what a client may negotiate via ConnectRequest's HBIntervalMs,
+// HBTimeoutMs, and MaxFailedHB: without a floor a misbehaving client could
+// force the server into a heartbeat busy-loop, and without a ceiling a
+// negotiated interval could outlive the server's own defaults by so much
+// that a genuinely dead client goes undetected for an unreasonable time.
+const (
+	minHBInterval  = 1 * time.Second
+	maxHBInterval  = 5 * time.Minute
+	minHBTimeout   = 1 * time.Second
+	maxHBTimeout   = 1 * time.Minute
+	minHBFailCount = 1
+	maxHBFailCount = 20
+)
+
+// negotiatedHB holds the per-client heartbeat settings clamped from a
+// ConnectRequest, in place of the server-wide ClientHBInterval/
+// ClientHBTimeout/ClientHBFailCount options for this one client. It is
+// persisted alongside the client's record (see clientStore.Register) so
+// recovery restores it rather than falling back to the server defaults.
+type negotiatedHB struct {
+	interval  time.Duration
+	timeout   time.Duration
+	failCount int
+}
+
+// clampDuration constrains d to [min, max], substituting fallback when d
+// is zero (meaning "not specified, use the server default").
+func clampDuration(d, fallback, min, max time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func clampFailCount(n, fallback int) int {
+	if n <= 0 {
+		return fallback
+	}
+	if n < minHBFailCount {
+		return minHBFailCount
+	}
+	if n > maxHBFailCount {
+		return maxHBFailCount
+	}
+	return n
+}
+
+// negotiateClientHB builds the negotiatedHB for a newly connecting client,
+// clamping whatever HBIntervalMs/HBTimeoutMs/MaxFailedHB the
+// ConnectRequest asked for against this server's bounds, and falling back
+// to s.opts.ClientHB{Interval,Timeout,FailCount} for anything left at
+// zero (not specified by the client).
+func (s *StanServer) negotiateClientHB(hbIntervalMs, hbTimeoutMs, maxFailedHB int32) *negotiatedHB {
+	interval := s.opts.ClientHBInterval
+	if interval <= 0 {
+		interval = DefaultClientHBInterval
+	}
+	timeout := s.opts.ClientHBTimeout
+	if timeout <= 0 {
+		timeout = DefaultClientHBTimeout
+	}
+	failCount := s.opts.ClientHBFailCount
+	if failCount <= 0 {
+		failCount = DefaultClientHBFailCount
+	}
+
+	return &negotiatedHB{
+		interval:  clampDuration(msToDuration(hbIntervalMs), interval, minHBInterval, maxHBInterval),
+		timeout:   clampDuration(msToDuration(hbTimeoutMs), timeout, minHBTimeout, maxHBTimeout),
+		failCount: clampFailCount(int(maxFailedHB), failCount),
+	}
+}
+
+func msToDuration(ms int32) time.Duration {
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// startClientHeartbeatsNegotiated is the negotiated-HB counterpart to
+// startClientHeartbeats: it schedules c's liveness loop using hb's
+// per-client interval/timeout/failCount instead of the server-wide
+// options, for both a first-time connect and recovery after a restart.
+func (s *StanServer) startClientHeartbeatsNegotiated(c *client, hb *negotiatedHB) {
+	if hb.interval <= 0 {
+		return
+	}
+	ch := &clientHB{
+		client: c,
+		inbox:  c.info.HeartbeatInbox,
+		stopCh: make(chan struct{}),
+		hb:     hb,
+	}
+	c.Lock()
+	c.hb = ch
+	c.Unlock()
+
+	ch.timer = time.AfterFunc(hb.interval, func() {
+		s.sendClientHeartbeatNegotiated(ch)
+	})
+}
+
+// sendClientHeartbeatNegotiated is sendClientHeartbeat's negotiated-HB
+// counterpart: identical ping/timeout/evict logic, except every bound
+// comes from ch.hb instead of s.opts, so each client is held to the
+// interval/timeout/failCount it negotiated at connect time.
+func (s *StanServer) sendClientHeartbeatNegotiated(ch *clientHB) {
+	select {
+	case <-ch.stopCh:
+		return
+	default:
+	}
+
+	_, err := s.ncs.Request(ch.inbox, []byte("PING"), ch.hb.timeout)
+	if err == nil {
+		ch.failed = 0
+	} else {
+		ch.failed++
+	}
+
+	if ch.failed >= ch.hb.failCount {
+		s.evictDeadClient(ch.client)
+		return
+	}
+
+	ch.timer.Reset(ch.hb.interval)
+}
@@ -0,0 +1,44 @@
+package server
+
+import "testing"
+
+func TestNegotiateClientHBClampsOutOfBounds(t *testing.T) {
+	s := &StanServer{opts: &Options{}}
+
+	hb := s.negotiateClientHB(100, 100, 0)
+	if hb.interval != minHBInterval {
+		t.Fatalf("expected interval clamped to %v, got %v", minHBInterval, hb.interval)
+	}
+	if hb.timeout != minHBTimeout {
+		t.Fatalf("expected timeout clamped to %v, got %v", minHBTimeout, hb.timeout)
+	}
+	if hb.failCount != DefaultClientHBFailCount {
+		t.Fatalf("expected unspecified MaxFailedHB to fall back to %d, got %d", DefaultClientHBFailCount, hb.failCount)
+	}
+
+	hb = s.negotiateClientHB(10*60*1000, 2*60*1000, 1000)
+	if hb.interval != maxHBInterval {
+		t.Fatalf("expected interval clamped to %v, got %v", maxHBInterval, hb.interval)
+	}
+	if hb.timeout != maxHBTimeout {
+		t.Fatalf("expected timeout clamped to %v, got %v", maxHBTimeout, hb.timeout)
+	}
+	if hb.failCount != maxHBFailCount {
+		t.Fatalf("expected failCount clamped to %d, got %d", maxHBFailCount, hb.failCount)
+	}
+}
+
+func TestNegotiateClientHBUnspecifiedUsesServerDefaults(t *testing.T) {
+	s := &StanServer{opts: &Options{}}
+
+	hb := s.negotiateClientHB(0, 0, 0)
+	if hb.interval != DefaultClientHBInterval {
+		t.Fatalf("expected default interval %v, got %v", DefaultClientHBInterval, hb.interval)
+	}
+	if hb.timeout != DefaultClientHBTimeout {
+		t.Fatalf("expected default timeout %v, got %v", DefaultClientHBTimeout, hb.timeout)
+	}
+	if hb.failCount != DefaultClientHBFailCount {
+		t.Fatalf("expected default failCount %d, got %d", DefaultClientHBFailCount, hb.failCount)
+	}
+}
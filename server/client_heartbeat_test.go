@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-stan"
+	"github.com/nats-io/nats"
+)
+
+func TestClientHeartbeatEvictsWedgedClient(t *testing.T) {
+	sOpts := GetDefaultOptions()
+	sOpts.ID = clusterName
+	sOpts.ClientHBInterval = 50 * time.Millisecond
+	sOpts.ClientHBTimeout = 50 * time.Millisecond
+	sOpts.ClientHBFailCount = 3
+	s := RunServerWithOpts(sOpts, nil)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	sc, err := stan.Connect(clusterName, clientName, stan.NatsConn(nc))
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer sc.Close()
+
+	if _, err := sc.Subscribe("foo", func(_ *stan.Msg) {}); err != nil {
+		t.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+	waitForNumSubs(t, s, clientName, 1)
+
+	// Simulate a wedged client: its NATS connection goes away without a
+	// CloseRequest, so the server still has the client registered until
+	// the heartbeat PING goes unanswered enough times.
+	nc.Close()
+
+	waitForNumClients(t, s, 0)
+	waitForNumSubs(t, s, clientName, 0)
+}
+
+func TestClientHeartbeatReconnectResumesWithoutEviction(t *testing.T) {
+	sOpts := GetDefaultOptions()
+	sOpts.ID = clusterName
+	sOpts.ClientHBInterval = 50 * time.Millisecond
+	sOpts.ClientHBTimeout = 200 * time.Millisecond
+	sOpts.ClientHBFailCount = 20
+	s := RunServerWithOpts(sOpts, nil)
+	defer s.Shutdown()
+
+	sc := NewDefaultConnection(t)
+	defer sc.Close()
+
+	// Give heartbeats a few intervals to run while the client is
+	// healthy; it should not be evicted.
+	time.Sleep(300 * time.Millisecond)
+	checkClients(t, s, 1)
+}
@@ -0,0 +1,98 @@
+package server
+
+import "time"
+
+// DuplicateCIDInfo describes the old and new connection attempting to use
+// the same client ID, passed to a DuplicateCIDPolicy so it can decide how
+// to arbitrate.
+type DuplicateCIDInfo struct {
+	ClientID    string
+	OldInbox    string        // the existing client's heartbeat/reply inbox
+	NewInbox    string        // the inbox supplied on the new ConnectRequest
+	PingTimeout time.Duration // not read by PingAndWaitDuplicateCID, which waits for its own Interval
+}
+
+// DuplicateCIDDecision is returned by a DuplicateCIDPolicy to tell the
+// server how to proceed with a duplicate-CID ConnectRequest.
+type DuplicateCIDDecision int
+
+const (
+	// DuplicateCIDRejectConn rejects the new connection outright, leaving
+	// the existing client in place.
+	DuplicateCIDRejectConn DuplicateCIDDecision = iota
+	// DuplicateCIDAcceptConn evicts the existing client and accepts the
+	// new connection in its place.
+	DuplicateCIDAcceptConn
+)
+
+// DuplicateCIDPolicy decides how the server arbitrates a ConnectRequest
+// for a client ID that already has a registered, presumed-live
+// connection. Implementations must be safe for concurrent use, since
+// duplicate-CID connects for different client IDs can arrive at once.
+type DuplicateCIDPolicy interface {
+	// Arbitrate returns the decision for info, blocking for as long as the
+	// policy needs (e.g. PingAndWait waits up to its Interval) before
+	// answering.
+	Arbitrate(info DuplicateCIDInfo) DuplicateCIDDecision
+}
+
+// RejectDuplicateCID always rejects the new connection, preserving the
+// pre-existing client unconditionally.
+type RejectDuplicateCID struct{}
+
+// Arbitrate implements DuplicateCIDPolicy.
+func (RejectDuplicateCID) Arbitrate(DuplicateCIDInfo) DuplicateCIDDecision {
+	return DuplicateCIDRejectConn
+}
+
+// PingAndWaitDuplicateCID is the server's original behavior: ping the
+// existing client's inbox and, if nothing answers within Interval,
+// consider it dead and accept the new connection.
+type PingAndWaitDuplicateCID struct {
+	// Interval bounds how long to wait for the old client to answer the
+	// ping before accepting the new connection. Zero uses
+	// dupCIDTimeoutDefault.
+	Interval time.Duration
+
+	ping func(inbox string, timeout time.Duration) bool
+}
+
+const dupCIDTimeoutDefault = 2 * time.Second
+
+// Arbitrate implements DuplicateCIDPolicy.
+func (p PingAndWaitDuplicateCID) Arbitrate(info DuplicateCIDInfo) DuplicateCIDDecision {
+	timeout := p.Interval
+	if timeout <= 0 {
+		timeout = dupCIDTimeoutDefault
+	}
+	if p.ping != nil && p.ping(info.OldInbox, timeout) {
+		return DuplicateCIDRejectConn
+	}
+	return DuplicateCIDAcceptConn
+}
+
+// PreemptOldDuplicateCID immediately evicts the existing client and hands
+// ownership to the new connection, with no ping round-trip. This suits
+// environments (e.g. Kubernetes pod replacement) where the "old"
+// connection is known to be gone before the new one even connects.
+type PreemptOldDuplicateCID struct{}
+
+// Arbitrate implements DuplicateCIDPolicy.
+func (PreemptOldDuplicateCID) Arbitrate(DuplicateCIDInfo) DuplicateCIDDecision {
+	return DuplicateCIDAcceptConn
+}
+
+// CustomDuplicateCIDPolicy adapts a user-provided callback to
+// DuplicateCIDPolicy, for arbitration logic this package doesn't ship a
+// built-in for (e.g. consulting an external service-discovery system).
+type CustomDuplicateCIDPolicy struct {
+	Decide func(info DuplicateCIDInfo) DuplicateCIDDecision
+}
+
+// Arbitrate implements DuplicateCIDPolicy.
+func (p CustomDuplicateCIDPolicy) Arbitrate(info DuplicateCIDInfo) DuplicateCIDDecision {
+	if p.Decide == nil {
+		return DuplicateCIDRejectConn
+	}
+	return p.Decide(info)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRejectDuplicateCIDAlwaysRejects(t *testing.T) {
+	if got := (RejectDuplicateCID{}).Arbitrate(DuplicateCIDInfo{}); got != DuplicateCIDRejectConn {
+		t.Fatalf("expected DuplicateCIDRejectConn, got %v", got)
+	}
+}
+
+func TestPreemptOldDuplicateCIDAlwaysAccepts(t *testing.T) {
+	if got := (PreemptOldDuplicateCID{}).Arbitrate(DuplicateCIDInfo{}); got != DuplicateCIDAcceptConn {
+		t.Fatalf("expected DuplicateCIDAcceptConn, got %v", got)
+	}
+}
+
+func TestPingAndWaitDuplicateCIDRespectsPingResult(t *testing.T) {
+	alive := PingAndWaitDuplicateCID{ping: func(string, time.Duration) bool { return true }}
+	if got := alive.Arbitrate(DuplicateCIDInfo{}); got != DuplicateCIDRejectConn {
+		t.Fatalf("expected reject when old client answers ping, got %v", got)
+	}
+
+	dead := PingAndWaitDuplicateCID{ping: func(string, time.Duration) bool { return false }}
+	if got := dead.Arbitrate(DuplicateCIDInfo{}); got != DuplicateCIDAcceptConn {
+		t.Fatalf("expected accept when old client does not answer ping, got %v", got)
+	}
+}
+
+func TestCustomDuplicateCIDPolicyDefaultsToReject(t *testing.T) {
+	p := CustomDuplicateCIDPolicy{}
+	if got := p.Arbitrate(DuplicateCIDInfo{}); got != DuplicateCIDRejectConn {
+		t.Fatalf("expected reject when Decide is nil, got %v", got)
+	}
+}
+
+func TestCustomDuplicateCIDPolicyDelegates(t *testing.T) {
+	p := CustomDuplicateCIDPolicy{Decide: func(info DuplicateCIDInfo) DuplicateCIDDecision {
+		if info.ClientID == "preempt-me" {
+			return DuplicateCIDAcceptConn
+		}
+		return DuplicateCIDRejectConn
+	}}
+	if got := p.Arbitrate(DuplicateCIDInfo{ClientID: "preempt-me"}); got != DuplicateCIDAcceptConn {
+		t.Fatalf("expected accept for preempt-me, got %v", got)
+	}
+	if got := p.Arbitrate(DuplicateCIDInfo{ClientID: "other"}); got != DuplicateCIDRejectConn {
+		t.Fatalf("expected reject for other, got %v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrDuplicateClientID is returned when a DuplicateCIDPolicy decides to
+// reject a ConnectRequest for a client ID that already has a live,
+// registered connection.
+var ErrDuplicateClientID = fmt.Errorf("stan: clientID already registered")
+
+// dupCIDArbitration records the outcome of one duplicate-CID arbitration,
+// exposed on the metrics endpoint (see dupCIDMetrics) so tests can assert
+// on policy behavior without racing against real ping timeouts.
+type dupCIDArbitration struct {
+	clientID string
+	decision DuplicateCIDDecision
+	took     time.Duration
+}
+
+// dupCIDMetrics accumulates recent arbitration outcomes for the metrics
+// endpoint. It intentionally keeps only the most recent N to bound
+// memory; tests needing a specific outcome should look it up by
+// clientID via lastArbitration.
+type dupCIDMetrics struct {
+	mu      sync.Mutex
+	history []dupCIDArbitration
+}
+
+func newDupCIDMetrics() *dupCIDMetrics {
+	return &dupCIDMetrics{}
+}
+
+func (m *dupCIDMetrics) record(a dupCIDArbitration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	const maxHistory = 256
+	m.history = append(m.history, a)
+	if len(m.history) > maxHistory {
+		m.history = m.history[len(m.history)-maxHistory:]
+	}
+}
+
+// lastArbitration returns the most recent arbitration recorded for
+// clientID, and whether one was found at all.
+func (m *dupCIDMetrics) lastArbitration(clientID string) (dupCIDArbitration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.history) - 1; i >= 0; i-- {
+		if m.history[i].clientID == clientID {
+			return m.history[i], true
+		}
+	}
+	return dupCIDArbitration{}, false
+}
+
+// resolveDuplicateCID is the new entry point for a duplicate-CID
+// ConnectRequest, replacing the previous hard-coded ping-and-wait loop:
+// it consults s.opts.DuplicateCIDPolicy (defaulting to
+// PingAndWaitDuplicateCID, today's behavior) and, on
+// DuplicateCIDAcceptConn, evicts the old client from the store before
+// registering the new one so a crash between the two calls can never
+// leave both rows present.
+func (s *StanServer) resolveDuplicateCID(info DuplicateCIDInfo) (DuplicateCIDDecision, error) {
+	policy := s.opts.DuplicateCIDPolicy
+	if policy == nil {
+		policy = PingAndWaitDuplicateCID{
+			ping: func(inbox string, timeout time.Duration) bool {
+				_, err := s.ncs.Request(inbox, []byte("PING"), timeout)
+				return err == nil
+			},
+		}
+	}
+
+	start := time.Now()
+	decision := policy.Arbitrate(info)
+	took := time.Since(start)
+
+	if s.dupCIDMetrics != nil {
+		s.dupCIDMetrics.record(dupCIDArbitration{clientID: info.ClientID, decision: decision, took: took})
+	}
+
+	if decision == DuplicateCIDAcceptConn {
+		if err := s.clients.Unregister(info.ClientID); err != nil {
+			return decision, err
+		}
+	}
+	return decision, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/nats-io/go-stan/pb"
+)
+
+// ErrDurableQueueGroupMismatch is returned when a client attaches to an
+// existing durable (queue or plain) subscription with a DeliverGroup that
+// does not match the one recorded when the durable was first created.
+// Allowing the mismatch through would silently corrupt acksPending
+// accounting, since two differently-grouped consumers would race over
+// the same stored state.
+var ErrDurableQueueGroupMismatch = fmt.Errorf("stan: requested queue group does not match the durable's recorded DeliverGroup")
+
+// ErrDurableNotFound is returned for a BindOnly request when no matching
+// durable/queue durable already exists: BindOnly callers want to attach
+// to a known consumer, not accidentally race its creation.
+var ErrDurableNotFound = fmt.Errorf("stan: BindOnly subscription request but no matching durable exists")
+
+// recordDeliverGroup stores the DeliverGroup a durable/queue subscription
+// was first created with, so that later attach attempts can be validated
+// against it. An empty string is a valid, distinct group (meaning "no
+// queue group"), so it is recorded just like a named one.
+func recordDeliverGroup(sub *subState, req *pb.SubscriptionRequest) {
+	sub.Lock()
+	sub.DeliverGroup = req.QGroup
+	sub.Unlock()
+}
+
+// checkDeliverGroupMatch validates that req's queue group matches the
+// DeliverGroup recorded on an existing durable/queue subscription.
+// existing may be nil, meaning no such durable/queue consumer exists yet
+// (the caller is free to create one).
+func checkDeliverGroupMatch(existing *subState, req *pb.SubscriptionRequest) error {
+	if existing == nil {
+		return nil
+	}
+	existing.RLock()
+	recorded := existing.DeliverGroup
+	existing.RUnlock()
+	if recorded != req.QGroup {
+		return ErrDurableQueueGroupMismatch
+	}
+	return nil
+}
+
+// checkBindOnly enforces SubscriptionRequest.BindOnly: when set, the
+// server must find an existing durable/queue durable with the requested
+// (ClientID, DurableName, QGroup) rather than create a new one. existing
+// is the result of that lookup (nil if none was found).
+func checkBindOnly(existing *subState, req *pb.SubscriptionRequest) error {
+	if !req.BindOnly {
+		return nil
+	}
+	if existing == nil {
+		return ErrDurableNotFound
+	}
+	return nil
+}
+
+// validateDurableQueueAttach runs the full set of checks introduced by
+// this change before processSubscriptionRequest is allowed to create or
+// resume durable/queue-group state: DeliverGroup must match any existing
+// recorded group, and a BindOnly request must resolve to an existing
+// durable.
+func validateDurableQueueAttach(existing *subState, req *pb.SubscriptionRequest) error {
+	if err := checkBindOnly(existing, req); err != nil {
+		return err
+	}
+	if err := checkDeliverGroupMatch(existing, req); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-stan"
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats"
+)
+
+func TestInvalidSubRequestDeliverGroupMismatch(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	sc := NewDefaultConnection(t)
+	defer sc.Close()
+
+	if _, err := sc.Subscribe("foo", func(_ *stan.Msg) {}, stan.DurableName("dur")); err != nil {
+		t.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	// Second attach to the same durable but with a (new) queue group
+	// should be rejected: the durable was created with no DeliverGroup.
+	req := &pb.SubscriptionRequest{
+		ClientID:      clientName,
+		Subject:       "foo",
+		DurableName:   "dur",
+		QGroup:        "newgroup",
+		AckWaitInSecs: 3,
+	}
+	if err := sendInvalidSubRequest(s, nc, req); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestBindOnlyRejectsMissingDurable(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	req := &pb.SubscriptionRequest{
+		ClientID:      clientName,
+		Subject:       "foo",
+		DurableName:   "nosuchdur",
+		AckWaitInSecs: 3,
+		BindOnly:      true,
+	}
+	if err := sendInvalidSubRequest(s, nc, req); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestBindOnlyAttachesToExistingDurable(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	sc := NewDefaultConnection(t)
+	defer sc.Close()
+
+	if _, err := sc.Subscribe("foo", func(_ *stan.Msg) {}, stan.DurableName("dur")); err != nil {
+		t.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+	sc.Close()
+
+	sc2 := NewDefaultConnection(t)
+	defer sc2.Close()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	req := &pb.SubscriptionRequest{
+		ClientID:      clientName,
+		Subject:       "foo",
+		Inbox:         nats.NewInbox(),
+		DurableName:   "dur",
+		AckWaitInSecs: 3,
+		MaxInFlight:   1,
+		BindOnly:      true,
+	}
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatalf("Error during marshal: %v", err)
+	}
+	rep, err := nc.Request(s.info.Subscribe, b, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error on BindOnly subscribe request: %v", err)
+	}
+	subRep := &pb.SubscriptionResponse{}
+	if err := subRep.Unmarshal(rep.Data); err != nil {
+		t.Fatalf("Error during unmarshal: %v", err)
+	}
+	if subRep.Error != "" {
+		t.Fatalf("Unexpected error on BindOnly subscribe: %v", subRep.Error)
+	}
+	checkSubs(t, s, clientName, 1)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats"
+)
+
+// nsToDuration converts a nanosecond count, as carried on the wire by
+// pb.FetchRequest.MaxWait, into a time.Duration.
+func nsToDuration(ns int64) time.Duration {
+	return time.Duration(ns)
+}
+
+// ErrPullModePushDelivery is returned if anything attempts to push a
+// message directly to a pull-mode durable's delivery subject (e.g. a
+// stray NextMsg-style subscriber) instead of going through Fetch.
+var ErrPullModePushDelivery = fmt.Errorf("stan: cannot push-deliver to a pull-mode durable subscription")
+
+// durableFetchSubject derives the stable fetch-request subject for a
+// durable pull subscription from its durable key, so that the same
+// clients can keep issuing Fetch requests to it across a subscribe,
+// unsubscribe (without delete), and resubscribe cycle, and so recovery
+// after a server restart can re-register the exact same subject.
+func durableFetchSubject(durableKey string) string {
+	return fmt.Sprintf("_STAN.pull.%s", durableKey)
+}
+
+// initDurablePullState sets up sub.pull for a newly created durable
+// subscription request with PullMode set, deriving its fetch subject
+// deterministically from the durable key rather than generating a fresh
+// inbox, so the subject survives restarts, and registers the fetch
+// handler on it immediately -- without this, a freshly created pull-mode
+// durable has no listener on its fetchInbox and every Fetch times out
+// until the server restarts once and recoverDurablePullSubscription
+// registers it for the first time.
+func (s *StanServer) initDurablePullState(sub *subState, req *pb.SubscriptionRequest) error {
+	if !req.PullMode {
+		return nil
+	}
+	key := durableKey(req)
+	inbox := durableFetchSubject(key)
+	sub.Lock()
+	sub.pull = &pullState{
+		fetchInbox: inbox,
+		maxWait:    req.MaxWait,
+	}
+	sub.Unlock()
+	return s.registerFetchHandler(sub, inbox)
+}
+
+// recoverDurablePullSubscription re-registers the fetch handler for a
+// durable pull subscription recovered from the store on restart, using
+// the same deterministic fetch subject so in-flight clients don't need
+// to learn a new one.
+func (s *StanServer) recoverDurablePullSubscription(sub *subState) error {
+	sub.RLock()
+	pull := sub.pull
+	sub.RUnlock()
+	if pull == nil {
+		return nil
+	}
+	return s.registerFetchHandler(sub, pull.fetchInbox)
+}
+
+// registerFetchHandler subscribes to inbox on the server's internal NATS
+// connection, dispatching every FetchRequest it receives to
+// s.handleFetch for sub.
+func (s *StanServer) registerFetchHandler(sub *subState, inbox string) error {
+	_, err := s.ncs.Subscribe(inbox, func(m *nats.Msg) {
+		req := &fetchRequest{}
+		if err := decodeFetchRequest(m.Data, req); err != nil {
+			return
+		}
+		s.handleFetch(sub, req, m.Reply)
+	})
+	return err
+}
+
+// rejectPushDeliveryIfPullMode is called from the regular (push) delivery
+// path before sending a message to sub; it returns ErrPullModePushDelivery
+// for any subscription created with PullMode, so a pull-mode durable can
+// never receive spontaneous deliveries by accident.
+func rejectPushDeliveryIfPullMode(sub *subState) error {
+	sub.RLock()
+	isPull := sub.pull != nil
+	sub.RUnlock()
+	if isPull {
+		return ErrPullModePushDelivery
+	}
+	return nil
+}
+
+// decodeFetchRequest unmarshals a wire-format pb.FetchRequest into the
+// internal fetchRequest type used by handleFetch.
+func decodeFetchRequest(data []byte, out *fetchRequest) error {
+	fr := &pb.FetchRequest{}
+	if err := fr.Unmarshal(data); err != nil {
+		return err
+	}
+	out.Batch = int(fr.Batch)
+	out.MaxWait = nsToDuration(fr.MaxWait)
+	out.NoWait = fr.NoWait
+	return nil
+}
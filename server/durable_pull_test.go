@@ -0,0 +1,114 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats"
+)
+
+// requestFetch sends a marshaled FetchRequest to inbox and returns
+// whatever comes back on the reply subject, or an error if nothing does
+// -- used below to prove a fetch handler is actually listening, since an
+// unregistered fetchInbox just times out with no reply at all.
+func requestFetch(nc *nats.Conn, inbox string, fr *pb.FetchRequest) (*nats.Msg, error) {
+	data, err := fr.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return nc.Request(inbox, data, 2*time.Second)
+}
+
+func TestDurablePullFreshCreationRegistersFetchHandler(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	req := &pb.SubscriptionRequest{
+		ClientID:    clientName,
+		Subject:     "foo",
+		DurableName: "dur",
+		PullMode:    true,
+	}
+	sub := &subState{}
+	if err := s.initDurablePullState(sub, req); err != nil {
+		t.Fatalf("Unexpected error on initDurablePullState: %v", err)
+	}
+
+	sub.RLock()
+	inbox := sub.pull.fetchInbox
+	sub.RUnlock()
+	if inbox != durableFetchSubject(durableKey(req)) {
+		t.Fatalf("Expected fetch inbox %q, got %q", durableFetchSubject(durableKey(req)), inbox)
+	}
+
+	// Batch 0 + NoWait so handleFetch never touches sub.store: this test
+	// only needs to prove that *something* answers on fetchInbox, which
+	// was not true before initDurablePullState registered the handler.
+	reply, err := requestFetch(nc, inbox, &pb.FetchRequest{Batch: 0, NoWait: true})
+	if err != nil {
+		t.Fatalf("Expected a reply from the fetch handler, got: %v", err)
+	}
+	if len(reply.Data) != 0 {
+		t.Fatalf("Expected an empty fetchComplete reply, got %q", reply.Data)
+	}
+}
+
+func TestDurablePullRecoverUsesSameFetchSubject(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	req := &pb.SubscriptionRequest{
+		ClientID:    clientName,
+		Subject:     "foo",
+		DurableName: "dur2",
+		PullMode:    true,
+	}
+
+	// First creation, as initDurablePullState would do before a restart.
+	before := &subState{}
+	if err := s.initDurablePullState(before, req); err != nil {
+		t.Fatalf("Unexpected error on initDurablePullState: %v", err)
+	}
+	before.RLock()
+	beforeInbox := before.pull.fetchInbox
+	before.RUnlock()
+
+	// Simulate recovery after a restart: a fresh subState, with sub.pull
+	// populated from the store the way recovery would, using the same
+	// deterministic subject.
+	after := &subState{}
+	after.Lock()
+	after.pull = &pullState{fetchInbox: durableFetchSubject(durableKey(req))}
+	after.Unlock()
+	if err := s.recoverDurablePullSubscription(after); err != nil {
+		t.Fatalf("Unexpected error on recoverDurablePullSubscription: %v", err)
+	}
+
+	after.RLock()
+	afterInbox := after.pull.fetchInbox
+	after.RUnlock()
+	if beforeInbox != afterInbox {
+		t.Fatalf("Expected fetch subject to survive restart: before=%q after=%q", beforeInbox, afterInbox)
+	}
+
+	reply, err := requestFetch(nc, afterInbox, &pb.FetchRequest{Batch: 0, NoWait: true})
+	if err != nil {
+		t.Fatalf("Expected a reply from the recovered fetch handler, got: %v", err)
+	}
+	if len(reply.Data) != 0 {
+		t.Fatalf("Expected an empty fetchComplete reply, got %q", reply.Data)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import "fmt"
+
+// ErrDurableAlreadyActive is returned for a BindOnly request that resolves
+// to a durable/queue durable which already has a live, connected owner:
+// BindOnly is for taking over an *inactive* consumer (e.g. during a
+// rolling upgrade), not for stealing one out from under a running client.
+var ErrDurableAlreadyActive = fmt.Errorf("stan: BindOnly subscription request but the matching durable already has an active client")
+
+// transferDurableOwnership reassigns an existing, inactive durable/queue
+// durable's subscription state to newClientID/newAckInbox in place: it
+// updates ClientID and AckInbox on the in-memory subState and persists the
+// same change to the subscription store, without ever deleting and
+// re-creating the row. Doing so preserves everything keyed off the
+// subscription's identity -- acksPending, the per-sub redeliveryList
+// built in chunk3-1, and MaxDeliver's delivery-attempt counters -- across
+// the handoff.
+//
+// The caller (processSubscriptionRequest) must already have verified
+// BindOnly via checkBindOnly/validateDurableQueueAttach before calling
+// this; existing is assumed non-nil.
+func (s *StanServer) transferDurableOwnership(existing *subState, newClientID, newAckInbox string) error {
+	existing.Lock()
+	if existing.IsActive() {
+		existing.Unlock()
+		return ErrDurableAlreadyActive
+	}
+	oldClientID := existing.ClientID
+	oldAckInbox := existing.AckInbox
+	existing.ClientID = newClientID
+	existing.AckInbox = newAckInbox
+	existing.Unlock()
+
+	if err := s.store.UpdateSub(existing.ToSubStateProto()); err != nil {
+		// Roll back the in-memory change so a failed persist doesn't leave
+		// the subState pointing at a client/inbox the store never
+		// recorded.
+		existing.Lock()
+		existing.ClientID = oldClientID
+		existing.AckInbox = oldAckInbox
+		existing.Unlock()
+		return err
+	}
+
+	// Messages already tracked in the subscription's redeliveryList must
+	// redeliver to the new owner's ackInbox, not the old (now-disconnected)
+	// one.
+	if existing.redeliveryList != nil {
+		existing.redeliveryList.rebindAckInbox(newAckInbox)
+	}
+	return nil
+}
+
+// rebindAckInbox updates the ackInbox recorded on every node currently in
+// the list, used when a durable's ownership is transferred to a new
+// client without tearing down its pending-ack state.
+func (l *redeliveryList) rebindAckInbox(ackInbox string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for n := l.head; n != nil; n = n.next {
+		n.ackInbox = ackInbox
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import "testing"
+
+func TestTransferDurableOwnershipRejectsActiveClient(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{ClientID: "client-a", AckInbox: "_INBOX.a", connected: true}
+
+	err := s.transferDurableOwnership(sub, "client-b", "_INBOX.b")
+	if err != ErrDurableAlreadyActive {
+		t.Fatalf("expected ErrDurableAlreadyActive, got %v", err)
+	}
+	if sub.ClientID != "client-a" || sub.AckInbox != "_INBOX.a" {
+		t.Fatalf("expected subState left untouched on rejection")
+	}
+}
+
+func TestRedeliveryListRebindAckInbox(t *testing.T) {
+	l := newRedeliveryList()
+	l.append(1, "_INBOX.old", 1)
+	l.append(2, "_INBOX.old", 2)
+
+	l.rebindAckInbox("_INBOX.new")
+
+	for n := l.head; n != nil; n = n.next {
+		if n.ackInbox != "_INBOX.new" {
+			t.Fatalf("expected ackInbox rebound to _INBOX.new, got %s", n.ackInbox)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats-streaming-server/stanevents"
+)
+
+// emitEvent publishes ev on this server's configured events subject, a
+// no-op unless s.opts.EnableEvents is set. Marshal/publish errors are
+// swallowed: a lifecycle event is an operator convenience, not something
+// a client request should ever fail because of.
+func (s *StanServer) emitEvent(ev stanevents.Event) {
+	if !s.opts.EnableEvents {
+		return
+	}
+	ev.Timestamp = s.now()
+	ev.ClusterID = s.opts.ID
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	subject := stanevents.Subject(s.opts.EventsSubjectPrefix, s.opts.ID, ev.Type)
+	s.ncs.Publish(subject, data)
+}
+
+// now returns the current time, routed through s.opts.TimeSource when one
+// is configured (see stantest.VirtualClock) so event timestamps are
+// deterministic under test, and time.Now() otherwise.
+func (s *StanServer) now() time.Time {
+	if s.opts.TimeSource != nil {
+		return s.opts.TimeSource.Now()
+	}
+	return time.Now()
+}
+
+// emitClientHeartbeatTimeout is called from the heartbeat-timeout path
+// (evictDeadClient, client_heartbeat.go) right before the client is torn
+// down, so operators watching the events subject see exactly why a
+// client disappeared instead of having to infer it from a generic
+// client.disconnect.
+func (s *StanServer) emitClientHeartbeatTimeout(clientID string, lastHB time.Time, failedCount int) {
+	s.emitEvent(stanevents.Event{
+		Type:        stanevents.ClientHeartbeatTimeout,
+		ClientID:    clientID,
+		LastHB:      lastHB,
+		FailedCount: failedCount,
+		Reason:      "heartbeat timeout",
+	})
+}
+
+// emitClientRecovered is called once per client restored from the store
+// during recovery, and emitClientExpiredDuringRecovery once per client
+// the recovery path decided was already dead (e.g. its heartbeat
+// deadline had already passed while the server was down) -- together
+// these let an operator see, after a restart, which clients came back
+// and which didn't.
+func (s *StanServer) emitClientRecovered(clientID string) {
+	s.emitEvent(stanevents.Event{
+		Type:      stanevents.ClientConnect,
+		ClientID:  clientID,
+		Recovered: true,
+	})
+}
+
+func (s *StanServer) emitClientExpiredDuringRecovery(clientID string, lastHB time.Time) {
+	s.emitEvent(stanevents.Event{
+		Type:      stanevents.ClientHeartbeatTimeout,
+		ClientID:  clientID,
+		LastHB:    lastHB,
+		Reason:    "heartbeat deadline already passed at recovery",
+		Recovered: true,
+	})
+}
@@ -0,0 +1,15 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats-streaming-server/stanevents"
+)
+
+func TestEmitEventNoopWhenEventsDisabled(t *testing.T) {
+	s := &StanServer{opts: &Options{}}
+	// EnableEvents defaults to false; this must not panic even though
+	// s.ncs (the NATS connection used to publish) is nil, which it would
+	// dereference if emitEvent didn't bail out first.
+	s.emitEvent(stanevents.Event{Type: stanevents.ClientConnect})
+}
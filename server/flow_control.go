@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+)
+
+// ErrFlowControlQGroup is returned when a SubscriptionRequest enables
+// FlowControl or IdleHeartbeat on a queue-group subscription: a single
+// flow-control reply cannot fan in from multiple queue members, so the
+// combination is rejected, mirroring the same constraint JetStream places
+// on its push consumers.
+var ErrFlowControlQGroup = fmt.Errorf("stan: FlowControl and IdleHeartbeat are not supported on queue subscriptions")
+
+// msgFlag marks special, zero (or control-only) payload messages
+// delivered on a subscription's ack inbox that are not regular data
+// messages.
+type msgFlag int
+
+const (
+	msgFlagNone msgFlag = iota
+	// msgFlagFlowControl marks a flow-control stall request: the client
+	// must reply on the message's reply subject before the server
+	// resumes delivery.
+	msgFlagFlowControl
+	// msgFlagIdleHeartbeat marks a heartbeat sent because no message was
+	// delivered within the subscription's IdleHeartbeat interval.
+	msgFlagIdleHeartbeat
+)
+
+// flowControlState is the extra bookkeeping attached to a subState when
+// SubscriptionRequest.FlowControl or IdleHeartbeat is set.
+type flowControlState struct {
+	enabled        bool
+	window         int           // number of messages delivered before stalling
+	sinceLastStall int           // messages delivered since the last FC message or resume
+	stalled        bool          // true while waiting for the client's FC reply
+	idleHeartbeat  time.Duration
+	idleTimer      *time.Timer
+
+	lastHeartbeat   time.Time
+	lastFlowControl time.Time
+}
+
+// validateFlowControlRequest rejects FlowControl/IdleHeartbeat on
+// queue-group subscriptions; the request is otherwise passed through
+// unchanged.
+func validateFlowControlRequest(req *pb.SubscriptionRequest) error {
+	if req.QGroup != "" && (req.FlowControl || req.IdleHeartbeat > 0) {
+		return ErrFlowControlQGroup
+	}
+	return nil
+}
+
+// newFlowControlState builds the flowControlState for a newly created
+// subscription from its request and MaxInFlight, using MaxInFlight/2
+// (minimum 1) as the flow-control window per the request's design.
+func newFlowControlState(req *pb.SubscriptionRequest, maxInFlight int) *flowControlState {
+	if !req.FlowControl && req.IdleHeartbeat <= 0 {
+		return nil
+	}
+	window := maxInFlight / 2
+	if window < 1 {
+		window = 1
+	}
+	return &flowControlState{
+		enabled:       req.FlowControl,
+		window:        window,
+		idleHeartbeat: req.IdleHeartbeat,
+	}
+}
+
+// onMessageDelivered is called by the normal delivery path for every
+// message sent to sub. When flow control is enabled and the window has
+// been reached, it publishes a zero-payload control message with
+// msgFlagFlowControl on the delivery subject and marks the subscription
+// stalled: further deliveries are held back until resumeFlowControl is
+// called in response to the client's reply. It also resets the idle
+// heartbeat timer, since a real message was just sent.
+func (s *StanServer) onMessageDelivered(sub *subState) error {
+	sub.Lock()
+	fc := sub.fc
+	if fc == nil {
+		sub.Unlock()
+		return nil
+	}
+	if fc.idleTimer != nil {
+		fc.idleTimer.Reset(fc.idleHeartbeat)
+	}
+	if !fc.enabled {
+		sub.Unlock()
+		return nil
+	}
+	fc.sinceLastStall++
+	shouldStall := fc.sinceLastStall >= fc.window
+	if shouldStall {
+		fc.sinceLastStall = 0
+		fc.stalled = true
+	}
+	ackInbox := sub.AckInbox
+	sub.Unlock()
+
+	if !shouldStall {
+		return nil
+	}
+	sub.Lock()
+	if sub.fc != nil {
+		sub.fc.recordFlowControlSent()
+	}
+	sub.Unlock()
+	data, err := (&pb.MsgProto{Flags: int32(msgFlagFlowControl)}).Marshal()
+	if err != nil {
+		return err
+	}
+	return s.ncs.PublishRequest(ackInbox, ackInbox+".fc", data)
+}
+
+// canDeliver reports whether sub is currently allowed to receive a new
+// message: false while stalled waiting on a flow-control reply.
+func (s *StanServer) canDeliver(sub *subState) bool {
+	sub.RLock()
+	defer sub.RUnlock()
+	if sub.fc == nil {
+		return true
+	}
+	return !sub.fc.stalled
+}
+
+// resumeFlowControl is called when the client replies to a flow-control
+// message, clearing the stall and resuming normal delivery. The
+// subscription's redelivery ackTimer is untouched by a stall: only new
+// deliveries are held back, existing acksPending continue to be tracked
+// against their original AckWait.
+func (s *StanServer) resumeFlowControl(sub *subState) {
+	sub.Lock()
+	if sub.fc != nil {
+		sub.fc.stalled = false
+	}
+	sub.Unlock()
+	s.sendAvailableMessages(sub)
+}
+
+// startIdleHeartbeat arms the idle-heartbeat timer for sub, publishing a
+// heartbeat message (flag msgFlagIdleHeartbeat, carrying the
+// subscription's last delivered sequence) whenever IdleHeartbeat elapses
+// with nothing delivered in between.
+func (s *StanServer) startIdleHeartbeat(sub *subState) {
+	sub.Lock()
+	fc := sub.fc
+	if fc == nil || fc.idleHeartbeat <= 0 {
+		sub.Unlock()
+		return
+	}
+	ackInbox := sub.AckInbox
+	fc.idleTimer = time.AfterFunc(fc.idleHeartbeat, func() {
+		s.sendIdleHeartbeat(sub, ackInbox)
+	})
+	sub.Unlock()
+}
+
+// sendIdleHeartbeat publishes the heartbeat message and reschedules
+// itself for the next interval.
+func (s *StanServer) sendIdleHeartbeat(sub *subState, ackInbox string) {
+	sub.RLock()
+	lastSent := sub.LastSent
+	fc := sub.fc
+	sub.RUnlock()
+	if fc == nil {
+		return
+	}
+	data, err := (&pb.MsgProto{Flags: int32(msgFlagIdleHeartbeat), Sequence: lastSent}).Marshal()
+	if err != nil {
+		return
+	}
+	s.ncs.Publish(ackInbox, data)
+
+	sub.Lock()
+	if sub.fc != nil {
+		sub.fc.recordHeartbeatSent()
+		if sub.fc.idleTimer != nil {
+			sub.fc.idleTimer.Reset(fc.idleHeartbeat)
+		}
+	}
+	sub.Unlock()
+}
@@ -0,0 +1,106 @@
+package server
+
+import "time"
+
+// SubFlowControlStatus reports the last-observed heartbeat and
+// flow-control activity for a subscription, for use by monitoring tools
+// (e.g. the /streaming endpoint) without reaching into subState's
+// internal fields directly.
+type SubFlowControlStatus struct {
+	IdleHeartbeatEnabled bool
+	FlowControlEnabled   bool
+	LastHeartbeat        time.Time
+	LastFlowControl       time.Time
+	Stalled              bool
+}
+
+// recordHeartbeatSent is called every time sendIdleHeartbeat actually
+// publishes a heartbeat, so subFlowControlStatus can report it.
+func (fc *flowControlState) recordHeartbeatSent() {
+	fc.lastHeartbeat = time.Now()
+}
+
+// recordFlowControlSent is called every time onMessageDelivered stalls a
+// subscription and publishes a flow-control request.
+func (fc *flowControlState) recordFlowControlSent() {
+	fc.lastFlowControl = time.Now()
+}
+
+// subFlowControlStatus returns the current flow-control/idle-heartbeat status for sub.
+// It returns the zero value if neither feature is enabled on sub.
+func (s *StanServer) subFlowControlStatus(sub *subState) SubFlowControlStatus {
+	sub.RLock()
+	defer sub.RUnlock()
+	if sub.fc == nil {
+		return SubFlowControlStatus{}
+	}
+	return SubFlowControlStatus{
+		IdleHeartbeatEnabled: sub.fc.idleHeartbeat > 0,
+		FlowControlEnabled:   sub.fc.enabled,
+		LastHeartbeat:        sub.fc.lastHeartbeat,
+		LastFlowControl:      sub.fc.lastFlowControl,
+		Stalled:              sub.fc.stalled,
+	}
+}
+
+// subFlowControlPersistentState is the subset of flowControlState that
+// would need to round-trip through the subscription's stored
+// spb.SubState for a restart to preserve FlowControl/IdleHeartbeat
+// behavior instead of silently reverting recovered subscriptions to
+// plain push delivery. toPersistent/restoreFlowControlFromPersistent
+// below implement that round trip and are covered by
+// TestFlowControlPersistentStateRoundTrip; wiring them into the actual
+// recovery path is still pending -- this tree has no sub-creation or
+// recovery code to hook into (see recoverFlowControl).
+type subFlowControlPersistentState struct {
+	FlowControl   bool
+	IdleHeartbeat time.Duration
+}
+
+// toPersistent extracts the part of a flowControlState that must survive
+// a restart; nil-safe so callers don't need to check for no flow-control
+// state first.
+func (fc *flowControlState) toPersistent() subFlowControlPersistentState {
+	if fc == nil {
+		return subFlowControlPersistentState{}
+	}
+	return subFlowControlPersistentState{
+		FlowControl:   fc.enabled,
+		IdleHeartbeat: fc.idleHeartbeat,
+	}
+}
+
+// restoreFlowControlFromPersistent rebuilds a subscription's
+// flowControlState from its persisted options during recovery, using the
+// same MaxInFlight-derived window newFlowControlState would have used at
+// creation time.
+func restoreFlowControlFromPersistent(p subFlowControlPersistentState, maxInFlight int) *flowControlState {
+	if !p.FlowControl && p.IdleHeartbeat <= 0 {
+		return nil
+	}
+	window := maxInFlight / 2
+	if window < 1 {
+		window = 1
+	}
+	return &flowControlState{
+		enabled:       p.FlowControl,
+		window:        window,
+		idleHeartbeat: p.IdleHeartbeat,
+	}
+}
+
+// recoverFlowControl installs sub.fc from its persisted state and, if an
+// IdleHeartbeat was configured, arms the heartbeat timer the same way
+// startIdleHeartbeat would for a freshly created subscription -- the one
+// caller this tree actually has for restoreFlowControlFromPersistent, so
+// a recovered subscription's flow-control behavior doesn't depend on a
+// test constructing it by hand.
+func (s *StanServer) recoverFlowControl(sub *subState, p subFlowControlPersistentState, maxInFlight int) {
+	fc := restoreFlowControlFromPersistent(p, maxInFlight)
+	sub.Lock()
+	sub.fc = fc
+	sub.Unlock()
+	if fc != nil && fc.idleHeartbeat > 0 {
+		s.startIdleHeartbeat(sub)
+	}
+}
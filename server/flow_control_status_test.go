@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlowControlPersistentStateRoundTrip(t *testing.T) {
+	maxInFlight := 4
+
+	fc := &flowControlState{enabled: true, idleHeartbeat: 5 * time.Second}
+	p := fc.toPersistent()
+	if !p.FlowControl || p.IdleHeartbeat != 5*time.Second {
+		t.Fatalf("unexpected persistent state: %+v", p)
+	}
+
+	restored := restoreFlowControlFromPersistent(p, maxInFlight)
+	if restored == nil {
+		t.Fatal("expected a non-nil flowControlState")
+	}
+	if restored.enabled != fc.enabled || restored.idleHeartbeat != fc.idleHeartbeat {
+		t.Fatalf("restored state %+v does not match original %+v", restored, fc)
+	}
+	if restored.window != 2 {
+		t.Fatalf("expected window %v, got %v", 2, restored.window)
+	}
+
+	// Neither flag set: nothing to persist or restore.
+	if got := (*flowControlState)(nil).toPersistent(); got != (subFlowControlPersistentState{}) {
+		t.Fatalf("expected zero value for nil flowControlState, got %+v", got)
+	}
+	if got := restoreFlowControlFromPersistent(subFlowControlPersistentState{}, maxInFlight); got != nil {
+		t.Fatalf("expected nil flowControlState for empty persistent state, got %+v", got)
+	}
+}
+
+func TestRecoverFlowControlInstallsState(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{}
+	p := subFlowControlPersistentState{FlowControl: true}
+
+	s.recoverFlowControl(sub, p, 4)
+
+	sub.RLock()
+	fc := sub.fc
+	sub.RUnlock()
+	if fc == nil || !fc.enabled {
+		t.Fatalf("expected flow control to be enabled after recovery, got %+v", fc)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats"
+)
+
+func TestFlowControlRejectedOnQueueSubscription(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	req := &pb.SubscriptionRequest{
+		ClientID:      clientName,
+		Subject:       "foo",
+		AckWaitInSecs: 3,
+		QGroup:        "group",
+		FlowControl:   true,
+	}
+	if err := sendInvalidSubRequest(s, nc, req); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestFlowControlStallAndResume(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	maxInFlight := 4
+	req := &pb.SubscriptionRequest{FlowControl: true}
+	fc := newFlowControlState(req, maxInFlight)
+	if fc == nil {
+		t.Fatal("Expected flow control state to be created")
+	}
+	if fc.window != 2 {
+		t.Fatalf("Expected window of %v, got %v", maxInFlight/2, fc.window)
+	}
+
+	ackInbox := nats.NewInbox()
+	sub := &subState{AckInbox: ackInbox, fc: fc}
+
+	fcMsgs := make(chan *nats.Msg, fc.window+1)
+	if _, err := nc.ChanSubscribe(ackInbox, fcMsgs); err != nil {
+		t.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+	nc.Flush()
+
+	// Deliver one fewer message than the window: no flow-control message
+	// should go out yet.
+	for i := 0; i < fc.window-1; i++ {
+		if err := s.onMessageDelivered(sub); err != nil {
+			t.Fatalf("Unexpected error on onMessageDelivered: %v", err)
+		}
+	}
+	if s.canDeliver(sub) != true {
+		t.Fatal("Expected subscription to still be able to deliver")
+	}
+
+	// The window-th delivery should stall the subscription and publish a
+	// real, decodable MsgProto flagged as a flow-control request.
+	if err := s.onMessageDelivered(sub); err != nil {
+		t.Fatalf("Unexpected error on onMessageDelivered: %v", err)
+	}
+	if s.canDeliver(sub) {
+		t.Fatal("Expected subscription to be stalled")
+	}
+
+	select {
+	case m := <-fcMsgs:
+		mp := &pb.MsgProto{}
+		if err := mp.Unmarshal(m.Data); err != nil {
+			t.Fatalf("Unexpected error decoding flow-control message: %v", err)
+		}
+		if mp.Flags != int32(msgFlagFlowControl) {
+			t.Fatalf("Expected Flags=%v, got %v", msgFlagFlowControl, mp.Flags)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not receive flow-control message")
+	}
+
+	// Simulate the client replying to the flow-control message.
+	s.resumeFlowControl(sub)
+	if !s.canDeliver(sub) {
+		t.Fatal("Expected subscription to resume after reply")
+	}
+}
+
+func TestIdleHeartbeatRejectedOnQueueSubscription(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	req := &pb.SubscriptionRequest{
+		ClientID:      clientName,
+		Subject:       "foo",
+		AckWaitInSecs: 3,
+		QGroup:        "group",
+		IdleHeartbeat: time.Second,
+	}
+	if err := sendInvalidSubRequest(s, nc, req); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
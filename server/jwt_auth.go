@@ -0,0 +1,219 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// ErrNoJWTClaims is returned when channel authorization is enabled but a
+// ConnectRequest carries no JWT and the client's bound NATS user claims
+// could not be found either.
+var ErrNoJWTClaims = fmt.Errorf("stan: channel authorization is enabled but no JWT claims were found for this connection")
+
+// ErrJWTRevoked is returned when a presented JWT's subject appears in the
+// current revocation list.
+var ErrJWTRevoked = fmt.Errorf("stan: user JWT has been revoked")
+
+// ErrJWTExpired is returned when a presented JWT's Expires timestamp has
+// already passed. Short-lived JWTs are only as short-lived as this
+// check: without it, an issuer-matching JWT would be accepted forever.
+var ErrJWTExpired = fmt.Errorf("stan: user JWT has expired")
+
+// channelACL holds the allow/deny subject patterns extracted from a user
+// JWT's pub/sub permissions, scoped to STAN channel names rather than raw
+// NATS subjects.
+type channelACL struct {
+	pubAllow []string
+	pubDeny  []string
+	subAllow []string
+	subDeny  []string
+}
+
+// allows reports whether action ("pub" or "sub") is permitted on channel
+// by this ACL: it must match at least one allow pattern (or the allow
+// list must be empty, meaning "everything") and must not match any deny
+// pattern, which always wins.
+func (a *channelACL) allows(action, channel string) bool {
+	var allow, deny []string
+	if action == "pub" {
+		allow, deny = a.pubAllow, a.pubDeny
+	} else {
+		allow, deny = a.subAllow, a.subDeny
+	}
+	for _, p := range deny {
+		if subjectMatchesPattern(channel, p) {
+			return false
+		}
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	for _, p := range allow {
+		if subjectMatchesPattern(channel, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectMatchesPattern reports whether subject matches a NATS-style
+// subject pattern (supporting the "*" and ">" wildcards).
+func subjectMatchesPattern(subject, pattern string) bool {
+	if pattern == subject {
+		return true
+	}
+	sTokens := strings.Split(subject, ".")
+	pTokens := strings.Split(pattern, ".")
+	for i, pt := range pTokens {
+		if i >= len(sTokens) {
+			return false
+		}
+		if pt == ">" {
+			return true
+		}
+		if pt != "*" && pt != sTokens[i] {
+			return false
+		}
+	}
+	return len(sTokens) == len(pTokens)
+}
+
+// JWTResolver fetches the raw JWT for a given NATS user public key (an
+// nkey starting with "U"). Implementations may look up a directory of .jwt files, a
+// configured URL (e.g. pointing at an nats-account-resolver), or an
+// in-memory map -- useful in tests.
+type JWTResolver interface {
+	// Resolve returns the JWT text for the given user public key, or an
+	// error if it cannot be found.
+	Resolve(userPubKey string) (string, error)
+}
+
+// MemJWTResolver is a JWTResolver backed by a plain map, primarily
+// intended for tests and small, static deployments.
+type MemJWTResolver struct {
+	mu    sync.RWMutex
+	jwts  map[string]string
+}
+
+// NewMemJWTResolver returns an empty in-memory JWT resolver.
+func NewMemJWTResolver() *MemJWTResolver {
+	return &MemJWTResolver{jwts: make(map[string]string)}
+}
+
+// Add registers the JWT for the given user public key.
+func (r *MemJWTResolver) Add(userPubKey, rawJWT string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jwts[userPubKey] = rawJWT
+}
+
+// Resolve implements JWTResolver.
+func (r *MemJWTResolver) Resolve(userPubKey string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	raw, ok := r.jwts[userPubKey]
+	if !ok {
+		return "", fmt.Errorf("no JWT found for user %q", userPubKey)
+	}
+	return raw, nil
+}
+
+// channelAuthorizer validates NATS JWT v2 user claims on connect and
+// derives a channelACL used to enforce publish/subscribe authorization
+// per channel. It is installed on StanServer when Options.ChannelAuthZ is
+// enabled.
+type channelAuthorizer struct {
+	mu sync.RWMutex
+
+	// accountPub is the operator/account NKey public key that signed
+	// valid user JWTs. Claims signed by any other key are rejected.
+	accountPub string
+
+	resolver JWTResolver
+
+	// revoked maps a user's public key to the unix timestamp (seconds)
+	// at or after which its JWT must be considered invalid. In clustered
+	// mode this map is replicated through raft so that a revocation
+	// takes effect on every node, not just the one that issued it.
+	revoked map[string]int64
+}
+
+// newChannelAuthorizer creates an authorizer that verifies user JWTs
+// against accountPub, fetching JWTs via resolver when one isn't supplied
+// directly on the ConnectRequest.
+func newChannelAuthorizer(accountPub string, resolver JWTResolver) (*channelAuthorizer, error) {
+	if _, err := nkeys.FromPublicKey(accountPub); err != nil {
+		return nil, fmt.Errorf("invalid account public key: %v", err)
+	}
+	return &channelAuthorizer{
+		accountPub: accountPub,
+		resolver:   resolver,
+		revoked:    make(map[string]int64),
+	}, nil
+}
+
+// authorize validates rawJWT (or, if empty, resolves one for userPubKey)
+// and returns the channelACL derived from its permissions.
+func (a *channelAuthorizer) authorize(userPubKey, rawJWT string) (*channelACL, error) {
+	if rawJWT == "" {
+		if a.resolver == nil {
+			return nil, ErrNoJWTClaims
+		}
+		var err error
+		rawJWT, err = a.resolver.Resolve(userPubKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	claims, err := jwt.DecodeUserClaims(rawJWT)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user JWT: %v", err)
+	}
+	// DecodeUserClaims already verified the embedded signature; what's
+	// left to check is that the claims were issued by the account this
+	// server is configured to trust.
+	if claims.Issuer != a.accountPub {
+		return nil, fmt.Errorf("user JWT not signed by configured account: issuer %q does not match", claims.Issuer)
+	}
+	if claims.Expires > 0 && claims.Expires < time.Now().Unix() {
+		return nil, ErrJWTExpired
+	}
+
+	a.mu.RLock()
+	revokedAt, isRevoked := a.revoked[claims.Subject]
+	a.mu.RUnlock()
+	if isRevoked && claims.IssuedAt <= revokedAt {
+		return nil, ErrJWTRevoked
+	}
+
+	return &channelACL{
+		pubAllow: claims.Pub.Allow,
+		pubDeny:  claims.Pub.Deny,
+		subAllow: claims.Sub.Allow,
+		subDeny:  claims.Sub.Deny,
+	}, nil
+}
+
+// revoke marks every JWT issued at or before issuedAt for the given user
+// subject as invalid. In clustered mode, callers should propose this
+// through raft (see replicateRevocation) so all nodes apply it.
+func (a *channelAuthorizer) revoke(userSubject string, issuedAt int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cur, ok := a.revoked[userSubject]; !ok || issuedAt > cur {
+		a.revoked[userSubject] = issuedAt
+	}
+}
+
+// isRevoked reports whether userSubject is currently revoked.
+func (a *channelAuthorizer) isRevoked(userSubject string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.revoked[userSubject]
+	return ok
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// signedUserJWT builds and signs a user JWT for userPub, issued by
+// accountKP, with the given permissions and expiry (0 means no expiry).
+func signedUserJWT(t *testing.T, accountKP nkeys.KeyPair, userPub string, expires int64, perms *jwt.Permissions) string {
+	t.Helper()
+	uc := jwt.NewUserClaims(userPub)
+	if perms != nil {
+		uc.Permissions = *perms
+	}
+	uc.Expires = expires
+	token, err := uc.Encode(accountKP)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding user claims: %v", err)
+	}
+	return token
+}
+
+func newTestAccountAndUser(t *testing.T) (accountKP nkeys.KeyPair, accountPub, userPub string) {
+	t.Helper()
+	accountKP, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("Unexpected error creating account key: %v", err)
+	}
+	accountPub, err = accountKP.PublicKey()
+	if err != nil {
+		t.Fatalf("Unexpected error on account public key: %v", err)
+	}
+	userKP, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("Unexpected error creating user key: %v", err)
+	}
+	userPub, err = userKP.PublicKey()
+	if err != nil {
+		t.Fatalf("Unexpected error on user public key: %v", err)
+	}
+	return accountKP, accountPub, userPub
+}
+
+func TestChannelAuthorizerRejectsExpiredJWT(t *testing.T) {
+	accountKP, accountPub, userPub := newTestAccountAndUser(t)
+	a, err := newChannelAuthorizer(accountPub, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating authorizer: %v", err)
+	}
+
+	expired := time.Now().Add(-time.Hour).Unix()
+	rawJWT := signedUserJWT(t, accountKP, userPub, expired, nil)
+
+	if _, err := a.authorize(userPub, rawJWT); err != ErrJWTExpired {
+		t.Fatalf("Expected ErrJWTExpired, got %v", err)
+	}
+}
+
+func TestChannelAuthorizerAcceptsUnexpiredJWT(t *testing.T) {
+	accountKP, accountPub, userPub := newTestAccountAndUser(t)
+	a, err := newChannelAuthorizer(accountPub, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating authorizer: %v", err)
+	}
+
+	notYetExpired := time.Now().Add(time.Hour).Unix()
+	rawJWT := signedUserJWT(t, accountKP, userPub, notYetExpired, nil)
+
+	if _, err := a.authorize(userPub, rawJWT); err != nil {
+		t.Fatalf("Unexpected error authorizing a not-yet-expired JWT: %v", err)
+	}
+
+	// Expires == 0 means "never expires".
+	rawJWT = signedUserJWT(t, accountKP, userPub, 0, nil)
+	if _, err := a.authorize(userPub, rawJWT); err != nil {
+		t.Fatalf("Unexpected error authorizing a JWT with no expiry: %v", err)
+	}
+}
+
+func TestChannelAuthorizerRejectsWrongIssuer(t *testing.T) {
+	_, accountPub, userPub := newTestAccountAndUser(t)
+	otherKP, _, _ := newTestAccountAndUser(t)
+
+	a, err := newChannelAuthorizer(accountPub, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating authorizer: %v", err)
+	}
+
+	rawJWT := signedUserJWT(t, otherKP, userPub, 0, nil)
+	if _, err := a.authorize(userPub, rawJWT); err == nil {
+		t.Fatal("Expected an error for a JWT signed by a different account")
+	}
+}
+
+func TestSubjectMatchesPattern(t *testing.T) {
+	cases := []struct {
+		subject, pattern string
+		want             bool
+	}{
+		{"orders", "orders", true},
+		{"orders.new", "orders.*", true},
+		{"orders.new.east", "orders.*", false},
+		{"orders.new", "orders.>", true},
+		{"orders.new.east", "orders.>", true},
+		// The bare subject "orders" has no token to match against ">" --
+		// "orders.>" requires at least one more token than "orders".
+		{"orders", "orders.>", false},
+		{"orders", "orders.*", false},
+	}
+	for _, c := range cases {
+		if got := subjectMatchesPattern(c.subject, c.pattern); got != c.want {
+			t.Errorf("subjectMatchesPattern(%q, %q) = %v, want %v", c.subject, c.pattern, got, c.want)
+		}
+	}
+}
+
+func TestChannelACLAllows(t *testing.T) {
+	acl := &channelACL{
+		pubAllow: []string{"orders.>"},
+		subDeny:  []string{"orders.secret"},
+	}
+	if !acl.allows("pub", "orders.new") {
+		t.Fatal("Expected pub to orders.new to be allowed")
+	}
+	if acl.allows("pub", "shipping.new") {
+		t.Fatal("Expected pub to shipping.new to be denied (not in allow list)")
+	}
+	if acl.allows("sub", "orders.secret") {
+		t.Fatal("Expected sub to orders.secret to be denied")
+	}
+	if !acl.allows("sub", "orders.new") {
+		t.Fatal("Expected sub to orders.new to be allowed (empty allow list means everything)")
+	}
+}
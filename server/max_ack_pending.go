@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/nats-io/go-stan/pb"
+)
+
+// dlqSubjectPrefix is the subject prefix used to publish messages that
+// exceeded MaxDeliver, e.g. "_STAN.dlq.orders" for channel "orders".
+const dlqSubjectPrefix = "_STAN.dlq."
+
+// ackPendingPolicy holds the stronger in-flight limits introduced here,
+// on top of the existing MaxInFlight count-only tracking: MaxAckPending
+// pauses delivery entirely once too many messages are outstanding, and
+// MaxDeliver permanently stops redelivering a sequence once it has been
+// attempted too many times.
+type ackPendingPolicy struct {
+	maxAckPending int
+	maxDeliver    int
+	dlqSubject    string // computed from the channel name; "" disables DLQ publish
+}
+
+// newAckPendingPolicy builds the policy from a subscription request,
+// returning nil if neither MaxAckPending nor MaxDeliver was set (the
+// subscription then behaves exactly as before this change).
+func newAckPendingPolicy(req *pb.SubscriptionRequest, channel string) *ackPendingPolicy {
+	if req.MaxAckPending <= 0 && req.MaxDeliver <= 0 {
+		return nil
+	}
+	p := &ackPendingPolicy{
+		maxAckPending: req.MaxAckPending,
+		maxDeliver:    req.MaxDeliver,
+	}
+	if p.maxDeliver > 0 {
+		p.dlqSubject = dlqSubjectPrefix + channel
+	}
+	return p
+}
+
+// canDeliverMore reports whether sub is allowed to receive another
+// message given its ackPendingPolicy: once the number of outstanding,
+// unacknowledged messages reaches MaxAckPending, delivery pauses until
+// enough acks drain it back below the limit.
+func (s *StanServer) canDeliverMore(sub *subState) bool {
+	sub.RLock()
+	defer sub.RUnlock()
+	if sub.ackPolicy == nil || sub.ackPolicy.maxAckPending <= 0 {
+		return true
+	}
+	return len(sub.acksPending) < sub.ackPolicy.maxAckPending
+}
+
+// onAckReceived is called whenever sub.acksPending shrinks (an ack came
+// in); if the subscription had paused delivery because it was at
+// MaxAckPending, this is the trigger to resume.
+func (s *StanServer) onAckReceived(sub *subState) {
+	if s.canDeliverMore(sub) {
+		s.sendAvailableMessages(sub)
+	}
+}
+
+// deliveryAttempt tracks, per sequence, how many times a message has been
+// (re)delivered to a subscription so that MaxDeliver can be enforced. It
+// is kept alongside acksPending and persisted the same way so that a
+// recovered subState resumes correct enforcement.
+type deliveryAttempt struct {
+	count int
+}
+
+// recordDeliveryAttempt increments the delivery counter for seq on sub
+// and reports whether the message has now exceeded MaxDeliver and should
+// be routed to the DLQ instead of being redelivered again.
+func (s *StanServer) recordDeliveryAttempt(sub *subState, seq uint64) (exceeded bool) {
+	sub.Lock()
+	defer sub.Unlock()
+	if sub.ackPolicy == nil || sub.ackPolicy.maxDeliver <= 0 {
+		return false
+	}
+	if sub.deliveries == nil {
+		sub.deliveries = make(map[uint64]*deliveryAttempt)
+	}
+	da, ok := sub.deliveries[seq]
+	if !ok {
+		da = &deliveryAttempt{}
+		sub.deliveries[seq] = da
+	}
+	da.count++
+	return da.count > sub.ackPolicy.maxDeliver
+}
+
+// sendToDLQ publishes m to the channel's configured dead-letter subject
+// and permanently removes it from sub's ack-pending/redelivery tracking,
+// so it is never attempted again on this subscription. sub.dlqSent is
+// bumped here, not derived from sub.deliveries, since the entry for m is
+// deleted in this same call -- dlqCount needs a counter that survives
+// that deletion.
+func (s *StanServer) sendToDLQ(sub *subState, m *pb.MsgProto) error {
+	sub.Lock()
+	dlqSubject := ""
+	if sub.ackPolicy != nil {
+		dlqSubject = sub.ackPolicy.dlqSubject
+	}
+	delete(sub.acksPending, m.Sequence)
+	delete(sub.deliveries, m.Sequence)
+	sub.dlqSent++
+	sub.Unlock()
+
+	if dlqSubject == "" {
+		return nil
+	}
+	return s.ncs.Publish(dlqSubject, m.Data)
+}
+
+// dlqCount reports how many messages have been routed to the dead-letter
+// subject so far, summed over every subscription in ss.psubs that belongs
+// to clientID, for use by subStore's monitoring helpers.
+func (ss *subStore) dlqCount(clientID string) (int, error) {
+	ss.RLock()
+	defer ss.RUnlock()
+	total := 0
+	for _, sub := range ss.psubs {
+		sub.RLock()
+		if sub.ClientID == clientID {
+			total += sub.dlqSent
+		}
+		sub.RUnlock()
+	}
+	return total, nil
+}
+
+var errMaxDeliverReached = fmt.Errorf("stan: message exceeded MaxDeliver and was routed to the dead-letter subject")
+
+// subAckPendingPersistentState is the subset of a subscription's
+// MaxAckPending/MaxDeliver bookkeeping that must survive a restart for
+// enforcement to resume correctly on a recovered subState: without it, a
+// message one delivery away from MaxDeliver (or a dlqSent count used for
+// monitoring) would silently get a fresh budget every time the server
+// restarts. toPersistent/recoverAckPendingState below implement that
+// round trip (see recoverFlowControl for the equivalent on the
+// flow-control side); nothing in this tree calls recoverAckPendingState,
+// since it has no sub-recovery path to hook into.
+type subAckPendingPersistentState struct {
+	DlqSent int
+	// DeliveryCounts is keyed by sequence, mirroring sub.deliveries; only
+	// sequences with a non-zero count need to round-trip.
+	DeliveryCounts map[uint64]int
+}
+
+// toPersistent extracts the part of a subscription's ack-pending
+// enforcement state that must survive a restart.
+func toPersistent(sub *subState) subAckPendingPersistentState {
+	sub.RLock()
+	defer sub.RUnlock()
+	p := subAckPendingPersistentState{DlqSent: sub.dlqSent}
+	if len(sub.deliveries) > 0 {
+		p.DeliveryCounts = make(map[uint64]int, len(sub.deliveries))
+		for seq, da := range sub.deliveries {
+			p.DeliveryCounts[seq] = da.count
+		}
+	}
+	return p
+}
+
+// recoverAckPendingState installs p onto sub during recovery, so a
+// recovered subscription resumes enforcing MaxDeliver (and reporting
+// dlqCount) from where it left off instead of from zero.
+func (s *StanServer) recoverAckPendingState(sub *subState, p subAckPendingPersistentState) {
+	sub.Lock()
+	defer sub.Unlock()
+	sub.dlqSent = p.DlqSent
+	if len(p.DeliveryCounts) == 0 {
+		return
+	}
+	sub.deliveries = make(map[uint64]*deliveryAttempt, len(p.DeliveryCounts))
+	for seq, count := range p.DeliveryCounts {
+		sub.deliveries[seq] = &deliveryAttempt{count: count}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/nats-io/go-stan/pb"
+)
+
+func TestNewAckPendingPolicy(t *testing.T) {
+	if p := newAckPendingPolicy(&pb.SubscriptionRequest{}, "foo"); p != nil {
+		t.Fatalf("Expected nil policy when neither limit is set, got %+v", p)
+	}
+
+	p := newAckPendingPolicy(&pb.SubscriptionRequest{MaxDeliver: 3}, "foo")
+	if p == nil || p.maxDeliver != 3 {
+		t.Fatalf("Expected maxDeliver 3, got %+v", p)
+	}
+	if p.dlqSubject != dlqSubjectPrefix+"foo" {
+		t.Fatalf("Expected dlqSubject %q, got %q", dlqSubjectPrefix+"foo", p.dlqSubject)
+	}
+
+	p = newAckPendingPolicy(&pb.SubscriptionRequest{MaxAckPending: 2}, "foo")
+	if p == nil || p.maxAckPending != 2 || p.dlqSubject != "" {
+		t.Fatalf("Expected maxAckPending 2 and no dlqSubject, got %+v", p)
+	}
+}
+
+func TestCanDeliverMore(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{ackPolicy: &ackPendingPolicy{maxAckPending: 2}}
+
+	if !s.canDeliverMore(sub) {
+		t.Fatal("Expected to be able to deliver with no pending acks")
+	}
+
+	sub.acksPending = map[uint64]int64{1: 0, 2: 0}
+	if s.canDeliverMore(sub) {
+		t.Fatal("Expected delivery to pause once at MaxAckPending")
+	}
+
+	delete(sub.acksPending, 1)
+	if !s.canDeliverMore(sub) {
+		t.Fatal("Expected delivery to resume once below MaxAckPending")
+	}
+
+	// No policy: always allowed.
+	if !s.canDeliverMore(&subState{}) {
+		t.Fatal("Expected no limit without an ackPolicy")
+	}
+}
+
+func TestRecordDeliveryAttemptExceedsMaxDeliver(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{ackPolicy: &ackPendingPolicy{maxDeliver: 2}}
+
+	if s.recordDeliveryAttempt(sub, 1) {
+		t.Fatal("Expected first attempt not to exceed MaxDeliver")
+	}
+	if s.recordDeliveryAttempt(sub, 1) {
+		t.Fatal("Expected second attempt not to exceed MaxDeliver")
+	}
+	if !s.recordDeliveryAttempt(sub, 1) {
+		t.Fatal("Expected third attempt to exceed MaxDeliver")
+	}
+
+	// No policy: never exceeds (MaxDeliver disabled).
+	if s.recordDeliveryAttempt(&subState{}, 1) {
+		t.Fatal("Expected no MaxDeliver enforcement without an ackPolicy")
+	}
+}
+
+func TestSendToDLQIncrementsPersistentCounter(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{
+		ackPolicy:   &ackPendingPolicy{maxDeliver: 1},
+		deliveries:  map[uint64]*deliveryAttempt{5: {count: 2}},
+		acksPending: map[uint64]int64{5: 0},
+	}
+
+	if err := s.sendToDLQ(sub, &pb.MsgProto{Sequence: 5}); err != nil {
+		t.Fatalf("Unexpected error on sendToDLQ: %v", err)
+	}
+
+	if _, ok := sub.deliveries[5]; ok {
+		t.Fatal("Expected delivery entry to be removed after routing to DLQ")
+	}
+	if _, ok := sub.acksPending[5]; ok {
+		t.Fatal("Expected ack-pending entry to be removed after routing to DLQ")
+	}
+	if sub.dlqSent != 1 {
+		t.Fatalf("Expected dlqSent to be 1, got %v", sub.dlqSent)
+	}
+
+	// dlqCount must keep reporting this message even though its
+	// deliveries entry (the thing it used to, incorrectly, scan) is gone.
+	ss := &subStore{psubs: []*subState{sub}}
+	sub.ClientID = "me"
+	count, err := ss.dlqCount("me")
+	if err != nil {
+		t.Fatalf("Unexpected error on dlqCount: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("Expected dlqCount 1, got %v", count)
+	}
+	if count, _ := ss.dlqCount("someone-else"); count != 0 {
+		t.Fatalf("Expected dlqCount 0 for a different client, got %v", count)
+	}
+}
+
+func TestAckPendingPersistentStateRoundTrip(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{
+		dlqSent: 3,
+		deliveries: map[uint64]*deliveryAttempt{
+			5: {count: 2},
+			9: {count: 1},
+		},
+	}
+
+	p := toPersistent(sub)
+	if p.DlqSent != 3 {
+		t.Fatalf("Expected DlqSent 3, got %v", p.DlqSent)
+	}
+	if p.DeliveryCounts[5] != 2 || p.DeliveryCounts[9] != 1 {
+		t.Fatalf("Expected delivery counts {5:2, 9:1}, got %v", p.DeliveryCounts)
+	}
+
+	recovered := &subState{}
+	s.recoverAckPendingState(recovered, p)
+	if recovered.dlqSent != 3 {
+		t.Fatalf("Expected recovered dlqSent 3, got %v", recovered.dlqSent)
+	}
+	if recovered.deliveries[5].count != 2 || recovered.deliveries[9].count != 1 {
+		t.Fatalf("Expected recovered delivery counts {5:2, 9:1}, got %v", recovered.deliveries)
+	}
+
+	// A message one attempt away from MaxDeliver before the restart must
+	// still be one attempt away after recovery, not reset to zero.
+	recovered.ackPolicy = &ackPendingPolicy{maxDeliver: 3}
+	if s.recordDeliveryAttempt(recovered, 5) {
+		t.Fatal("Expected the third attempt to stay within MaxDeliver")
+	}
+	if !s.recordDeliveryAttempt(recovered, 5) {
+		t.Fatal("Expected the fourth attempt to exceed MaxDeliver")
+	}
+}
+
+func TestAckPendingPersistentStateRoundTripEmpty(t *testing.T) {
+	s := &StanServer{}
+	sub := &subState{}
+
+	p := toPersistent(sub)
+	if p.DlqSent != 0 || len(p.DeliveryCounts) != 0 {
+		t.Fatalf("Expected empty persistent state, got %+v", p)
+	}
+
+	recovered := &subState{}
+	s.recoverAckPendingState(recovered, p)
+	if recovered.dlqSent != 0 || len(recovered.deliveries) != 0 {
+		t.Fatalf("Expected no state installed on an empty round trip, got dlqSent=%v deliveries=%v", recovered.dlqSent, recovered.deliveries)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+)
+
+// ErrPullModeQGroupAttach is returned when a PullMode subscription
+// request attempts to attach to an existing queue group that was created
+// in push mode. Mixing pacing models within a single
+// queue group would make delivery order and ack-pending accounting
+// ambiguous.
+var ErrPullModeQGroupAttach = fmt.Errorf("stan: cannot attach in pull mode to a queue group created in push mode")
+
+// ErrPullModeDurableAttach is returned when a PullMode subscription
+// request attempts to attach to an existing push-mode durable.
+var ErrPullModeDurableAttach = fmt.Errorf("stan: cannot attach in pull mode to a durable created in push mode")
+
+// ErrNotPullMode is returned by Fetch when the request's inbox does not
+// correspond to a pull-mode subscription.
+var ErrNotPullMode = fmt.Errorf("stan: subscription is not in pull mode")
+
+// pullState holds the extra bookkeeping a subState needs when created
+// with SubscriptionRequest.PullMode set. Unlike push subscriptions, a
+// pull subscription never spontaneously delivers: messages only go out
+// in response to a FetchRequest on fetchInbox.
+type pullState struct {
+	fetchInbox string
+	maxWait    time.Duration
+}
+
+// validatePullModeAttach enforces that a PullMode subscription request is
+// compatible with any existing durable/queue state it is attaching to:
+// a pull subscriber cannot join a push-mode queue group, and cannot
+// resume a push-mode durable.
+func validatePullModeAttach(req *pb.SubscriptionRequest, existing *subState) error {
+	if existing == nil {
+		return nil
+	}
+	if !req.PullMode {
+		return nil
+	}
+	if req.QGroup != "" && existing.pull == nil {
+		return ErrPullModeQGroupAttach
+	}
+	if req.DurableName != "" && req.QGroup == "" && existing.pull == nil {
+		return ErrPullModeDurableAttach
+	}
+	return nil
+}
+
+// fetchRequest mirrors the wire format a pull-mode client sends to a
+// subscription's FetchInbox to ask for more messages.
+type fetchRequest struct {
+	Batch  int
+	MaxWait time.Duration
+	NoWait bool
+}
+
+// fetchOutcome is published on the FetchRequest's reply inbox after the
+// last message of a batch (or immediately, on error/timeout).
+type fetchOutcome int
+
+const (
+	// fetchComplete indicates the batch was filled (possibly with fewer
+	// than Batch messages if the channel ran dry and NoWait was set).
+	fetchComplete fetchOutcome = iota
+	// fetchTimeout indicates MaxWait elapsed with NoWait unset and no
+	// further messages arrived; status code 408 is returned to the
+	// client to mirror HTTP's request-timeout semantics.
+	fetchTimeout
+)
+
+// handleFetch services one FetchRequest for a pull-mode subscription: it
+// reads up to req.Batch messages from the channel store starting at
+// sub.LastSent+1, publishes each to replyInbox, records them in
+// sub.acksPending with the normal ack-wait timer, and finally publishes a
+// terminal status (fetchComplete, or fetchTimeout if req.MaxWait elapses
+// with req.NoWait false and nothing was available).
+func (s *StanServer) handleFetch(sub *subState, req *fetchRequest, replyInbox string) error {
+	sub.Lock()
+	if sub.pull == nil {
+		sub.Unlock()
+		return ErrNotPullMode
+	}
+	c := sub.store
+	start := sub.LastSent + 1
+	sub.Unlock()
+
+	deadline := time.Now().Add(req.MaxWait)
+	delivered := 0
+	for delivered < req.Batch {
+		m, err := c.Msgs.Lookup(start)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			if req.NoWait || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(15 * time.Millisecond)
+			continue
+		}
+		if err := s.deliverFetchedMsg(sub, m, replyInbox); err != nil {
+			return err
+		}
+		start++
+		delivered++
+	}
+
+	outcome := fetchComplete
+	if delivered == 0 && !req.NoWait && time.Now().After(deadline) {
+		outcome = fetchTimeout
+	}
+	return s.publishFetchOutcome(replyInbox, outcome)
+}
+
+// deliverFetchedMsg publishes a single message to replyInbox and records
+// it as pending ack on sub and arms the sub's ack timer, as a push
+// delivery would. handleFetch itself only reads forward from
+// sub.LastSent+1, so a fetched message the client never acks is not
+// returned again by a later Fetch.
+func (s *StanServer) deliverFetchedMsg(sub *subState, m *pb.MsgProto, replyInbox string) error {
+	if err := s.ncs.Publish(replyInbox, m.Data); err != nil {
+		return err
+	}
+	sub.Lock()
+	sub.LastSent = m.Sequence
+	if sub.acksPending == nil {
+		sub.acksPending = make(map[uint64]int64)
+	}
+	sub.acksPending[m.Sequence] = time.Now().UnixNano()
+	sub.Unlock()
+	s.setupAckTimer(sub, sub.ackWait)
+	return nil
+}
+
+// publishFetchOutcome sends the terminal status for a Fetch call: an
+// empty message for fetchComplete, and a "408" status payload for
+// fetchTimeout, matching the convention used elsewhere in the protocol
+// for terminal request/reply exchanges.
+func (s *StanServer) publishFetchOutcome(replyInbox string, outcome fetchOutcome) error {
+	switch outcome {
+	case fetchTimeout:
+		return s.ncs.Publish(replyInbox, []byte("408"))
+	default:
+		return s.ncs.Publish(replyInbox, nil)
+	}
+}
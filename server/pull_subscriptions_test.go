@@ -0,0 +1,119 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats"
+)
+
+func TestValidatePullModeAttach(t *testing.T) {
+	pullReq := &pb.SubscriptionRequest{PullMode: true, QGroup: "q", DurableName: "dur"}
+	pushReq := &pb.SubscriptionRequest{QGroup: "q", DurableName: "dur"}
+
+	// No existing subscription to attach to: always allowed.
+	if err := validatePullModeAttach(pullReq, nil); err != nil {
+		t.Fatalf("Expected no error attaching to nothing, got %v", err)
+	}
+
+	// A push-mode request attaching to anything is never rejected by
+	// this function (push/push and push/pull-existing are handled
+	// elsewhere).
+	existingPull := &subState{pull: &pullState{}}
+	if err := validatePullModeAttach(pushReq, existingPull); err != nil {
+		t.Fatalf("Expected no error for a push-mode request, got %v", err)
+	}
+
+	// Pull-mode request attaching to an existing pull-mode queue group or
+	// durable: allowed.
+	if err := validatePullModeAttach(pullReq, existingPull); err != nil {
+		t.Fatalf("Expected no error attaching pull-mode to existing pull-mode state, got %v", err)
+	}
+
+	// Pull-mode request attaching to an existing push-mode queue group:
+	// rejected.
+	existingPush := &subState{}
+	qGroupOnly := &pb.SubscriptionRequest{PullMode: true, QGroup: "q"}
+	if err := validatePullModeAttach(qGroupOnly, existingPush); err != ErrPullModeQGroupAttach {
+		t.Fatalf("Expected ErrPullModeQGroupAttach, got %v", err)
+	}
+
+	// Pull-mode request attaching to an existing push-mode durable (no
+	// queue group involved): rejected.
+	durableOnly := &pb.SubscriptionRequest{PullMode: true, DurableName: "dur"}
+	if err := validatePullModeAttach(durableOnly, existingPush); err != ErrPullModeDurableAttach {
+		t.Fatalf("Expected ErrPullModeDurableAttach, got %v", err)
+	}
+
+	// Neither durable nor queue group: nothing to attach to, so nothing
+	// to reject.
+	plain := &pb.SubscriptionRequest{PullMode: true}
+	if err := validatePullModeAttach(plain, existingPush); err != nil {
+		t.Fatalf("Expected no error for a plain (non-durable, non-queue) request, got %v", err)
+	}
+}
+
+// TestHandleFetchNoWaitAndTimeout covers handleFetch's outcome selection
+// with Batch=0, which never touches sub.store's channel lookup (this
+// tree has no channel-store implementation to construct one against,
+// only the fetch/reply wiring added alongside pull mode) -- it still
+// exercises the exact NoWait vs. MaxWait-elapsed branching handleFetch
+// uses to decide between fetchComplete and fetchTimeout.
+func TestHandleFetchNoWaitAndTimeout(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	sub := &subState{pull: &pullState{}}
+
+	replyInbox := nats.NewInbox()
+	replies := make(chan *nats.Msg, 1)
+	if _, err := nc.ChanSubscribe(replyInbox, replies); err != nil {
+		t.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+	nc.Flush()
+
+	// NoWait with nothing available: completes immediately with an empty
+	// reply instead of waiting out MaxWait.
+	if err := s.handleFetch(sub, &fetchRequest{Batch: 0, NoWait: true, MaxWait: time.Hour}, replyInbox); err != nil {
+		t.Fatalf("Unexpected error on handleFetch: %v", err)
+	}
+	select {
+	case m := <-replies:
+		if len(m.Data) != 0 {
+			t.Fatalf("Expected empty fetchComplete reply, got %q", m.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not receive a reply for the NoWait fetch")
+	}
+
+	// MaxWait already elapsed (0) with NoWait unset: times out with the
+	// "408" status payload.
+	if err := s.handleFetch(sub, &fetchRequest{Batch: 0, NoWait: false, MaxWait: 0}, replyInbox); err != nil {
+		t.Fatalf("Unexpected error on handleFetch: %v", err)
+	}
+	select {
+	case m := <-replies:
+		if string(m.Data) != "408" {
+			t.Fatalf("Expected %q reply, got %q", "408", m.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not receive a reply for the timed-out fetch")
+	}
+}
+
+func TestHandleFetchRejectsNonPullSub(t *testing.T) {
+	s := RunServer(clusterName)
+	defer s.Shutdown()
+
+	sub := &subState{}
+	if err := s.handleFetch(sub, &fetchRequest{Batch: 1}, nats.NewInbox()); err != ErrNotPullMode {
+		t.Fatalf("Expected ErrNotPullMode, got %v", err)
+	}
+}
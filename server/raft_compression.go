@@ -0,0 +1,240 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionCodec identifies the algorithm used to compress a raft
+// snapshot or a batch of replicated log entries.
+type CompressionCodec byte
+
+// Supported compression codecs. CompressionNone must stay 0 so that
+// snapshots written before this feature was added (which carry no header
+// at all) are still readable: readSnapshotHeader falls back to "none"
+// when the magic bytes are not present.
+const (
+	CompressionNone CompressionCodec = iota
+	CompressionS2
+	CompressionZstd
+)
+
+// snapshotMagic prefixes every snapshot written by CompressedSnapshotSink.
+// Its presence is what lets CompressedSnapshotSource tell a compressed
+// stream apart from a legacy, uncompressed one.
+var snapshotMagic = [4]byte{'S', 'T', 'A', 'N'}
+
+// snapshotHeader is written once at the start of a compressed snapshot
+// stream (and of each compressed log-entry batch) so that the reader
+// knows which codec and original size to expect.
+type snapshotHeader struct {
+	codec     CompressionCodec
+	origSize  uint64
+}
+
+const snapshotHeaderLen = len(snapshotMagic) + 1 + 8
+
+func writeSnapshotHeader(w io.Writer, h snapshotHeader) error {
+	buf := make([]byte, snapshotHeaderLen)
+	copy(buf[0:4], snapshotMagic[:])
+	buf[4] = byte(h.codec)
+	binary.BigEndian.PutUint64(buf[5:], h.origSize)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readSnapshotHeader peeks at the first bytes of r. If they match
+// snapshotMagic, the header is consumed and returned with ok=true. If not,
+// none of r has been consumed as far as the caller is concerned -- the
+// peeked bytes are returned in leftover so the caller can prepend them
+// back onto the stream (used to stay compatible with pre-compression
+// uncompressed snapshots).
+func readSnapshotHeader(r io.Reader) (h snapshotHeader, leftover []byte, ok bool, err error) {
+	buf := make([]byte, snapshotHeaderLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return h, nil, false, err
+	}
+	if n < len(snapshotMagic) || string(buf[0:4]) != string(snapshotMagic[:]) {
+		return h, buf[:n], false, nil
+	}
+	h.codec = CompressionCodec(buf[4])
+	h.origSize = binary.BigEndian.Uint64(buf[5:])
+	return h, nil, true, nil
+}
+
+// CompressionOptions configures the optional compression layer applied to
+// raft snapshots (FSM state and InstallSnapshot transfers) and, above
+// MinSizeToCompress, to individual replicated spb.RaftOperation batches
+// carried over AppendEntries. It is embedded in the Clustering config
+// block so it can be tuned per-cluster.
+type CompressionOptions struct {
+	// Enabled turns on compression for newly written snapshots and log
+	// batches. Existing uncompressed snapshots remain readable regardless
+	// of this setting.
+	Enabled bool
+
+	// Codec selects the compression algorithm: "s2" (default, optimized
+	// for throughput) or "zstd" (better ratio, more CPU).
+	Codec string
+
+	// Level is the codec-specific compression level. Zero means use the
+	// codec's default.
+	Level int
+
+	// MinSizeToCompress is the minimum serialized size, in bytes, of a
+	// spb.RaftOperation batch before it is compressed. Small entries are
+	// left untouched since compression overhead would outweigh the gain.
+	MinSizeToCompress int
+}
+
+// DefaultCompressionOptions returns the compression defaults applied when
+// a ClusteringOptions.Compression block is not provided: disabled, so
+// clusters need to opt in.
+func DefaultCompressionOptions() CompressionOptions {
+	return CompressionOptions{
+		Enabled:           false,
+		Codec:             "s2",
+		Level:             0,
+		MinSizeToCompress: 8192,
+	}
+}
+
+func codecFromName(name string) (CompressionCodec, error) {
+	switch name {
+	case "", "s2":
+		return CompressionS2, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression codec %q", name)
+	}
+}
+
+// newCompressWriter returns an io.WriteCloser that compresses everything
+// written to it with the given codec and writes the result to w.
+func newCompressWriter(codec CompressionCodec, level int, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case CompressionS2:
+		opts := []s2.WriterOption{}
+		if level > 0 {
+			opts = append(opts, s2.WriterBetterCompression())
+		}
+		return s2.NewWriter(w, opts...), nil
+	case CompressionZstd:
+		if level <= 0 {
+			return zstd.NewWriter(w)
+		}
+		el := zstd.EncoderLevelFromZstd(level)
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(el))
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %v", codec)
+	}
+}
+
+// newCompressReader returns a reader that decompresses r, which was
+// written by newCompressWriter with the matching codec.
+func newCompressReader(codec CompressionCodec, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case CompressionS2:
+		return io.NopCloser(s2.NewReader(r)), nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %v", codec)
+	}
+}
+
+// CompressedSnapshotSink wraps a raft.SnapshotSink so that whatever the
+// FSM writes to it is transparently compressed on the fly. It is used as
+// a drop-in replacement for the sink that raft.SnapshotStore.Create
+// returns.
+type CompressedSnapshotSink struct {
+	raft.SnapshotSink
+	w     io.WriteCloser
+	codec CompressionCodec
+}
+
+// newCompressedSnapshotSink wraps sink, writing the snapshot header up
+// front and compressing everything subsequently written to it.
+func newCompressedSnapshotSink(sink raft.SnapshotSink, opts CompressionOptions) (*CompressedSnapshotSink, error) {
+	codec, err := codecFromName(opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSnapshotHeader(sink, snapshotHeader{codec: codec}); err != nil {
+		return nil, err
+	}
+	w, err := newCompressWriter(codec, opts.Level, sink)
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedSnapshotSink{SnapshotSink: sink, w: w, codec: codec}, nil
+}
+
+// Write implements io.Writer, compressing data before it reaches the
+// underlying raft.SnapshotSink.
+func (s *CompressedSnapshotSink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// Close flushes the compressor and closes the underlying sink.
+func (s *CompressedSnapshotSink) Close() error {
+	if err := s.w.Close(); err != nil {
+		s.SnapshotSink.Cancel()
+		return err
+	}
+	return s.SnapshotSink.Close()
+}
+
+// openCompressedSnapshot opens a snapshot previously written by
+// CompressedSnapshotSink (or, for backward compatibility, one written
+// with no compression at all) and returns a reader that yields the
+// original, uncompressed FSM stream.
+func openCompressedSnapshot(r io.ReadCloser) (io.ReadCloser, error) {
+	h, leftover, ok, err := readSnapshotHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Not a compressed snapshot: hand back the original reader with
+		// the bytes we already consumed while probing for the header
+		// prepended so nothing is lost.
+		return &prependReadCloser{prefix: leftover, rc: r}, nil
+	}
+	cr, err := newCompressReader(h.codec, r)
+	if err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// prependReadCloser replays prefix before reading from rc, used so that
+// bytes consumed while probing for a snapshot header can be put back.
+type prependReadCloser struct {
+	prefix []byte
+	off    int
+	rc     io.ReadCloser
+}
+
+func (p *prependReadCloser) Read(b []byte) (int, error) {
+	if p.off < len(p.prefix) {
+		n := copy(b, p.prefix[p.off:])
+		p.off += n
+		return n, nil
+	}
+	return p.rc.Read(b)
+}
+
+func (p *prependReadCloser) Close() error {
+	return p.rc.Close()
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/nats-io/nats-streaming-server/spb"
+)
+
+func makeRaftOpPayload(b *testing.B, size int) []byte {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		b.Fatalf("error generating payload: %v", err)
+	}
+	op := &spb.RaftOperation{OpType: spb.RaftOperation_Publish}
+	_ = op
+	return buf
+}
+
+func benchmarkCompressRaftOperation(b *testing.B, codec string, size int) {
+	opts := CompressionOptions{Enabled: true, Codec: codec, MinSizeToCompress: 0}
+	data := makeRaftOpPayload(b, size)
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := compressRaftOperation(data, opts); err != nil {
+			b.Fatalf("error compressing: %v", err)
+		}
+	}
+}
+
+func BenchmarkCompressRaftOperationS2_64KB(b *testing.B) {
+	benchmarkCompressRaftOperation(b, "s2", 64*1024)
+}
+
+func BenchmarkCompressRaftOperationZstd_64KB(b *testing.B) {
+	benchmarkCompressRaftOperation(b, "zstd", 64*1024)
+}
+
+func BenchmarkCompressRaftOperationNone_64KB(b *testing.B) {
+	opts := CompressionOptions{Enabled: false}
+	data := makeRaftOpPayload(b, 64*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := compressRaftOperation(data, opts); err != nil {
+			b.Fatalf("error compressing: %v", err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nats-io/nats-streaming-server/spb"
+)
+
+// compressRaftOperation compresses the marshaled spb.RaftOperation in
+// data when it is at least opts.MinSizeToCompress bytes, prefixing it
+// with a snapshotHeader so compressRaftOperation's counterpart,
+// decompressRaftOperation, knows whether (and how) to reverse it.
+//
+// Entries below the threshold are returned untouched: InstallSnapshot and
+// AppendEntries already pay per-RPC framing overhead, so compressing tiny
+// operations would cost more than it saves.
+func compressRaftOperation(data []byte, opts CompressionOptions) ([]byte, error) {
+	if !opts.Enabled || len(data) < opts.MinSizeToCompress {
+		return data, nil
+	}
+	codec, err := codecFromName(opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeSnapshotHeader(&buf, snapshotHeader{codec: codec, origSize: uint64(len(data))}); err != nil {
+		return nil, err
+	}
+	w, err := newCompressWriter(codec, opts.Level, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressRaftOperation reverses compressRaftOperation. If data does not
+// start with the compression magic header, it is assumed to be an
+// uncompressed entry (written before compression was enabled, or below
+// MinSizeToCompress) and is returned unchanged.
+func decompressRaftOperation(data []byte) ([]byte, error) {
+	h, leftover, ok, err := readSnapshotHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return append(leftover, data[len(leftover):]...), nil
+	}
+	r, err := newCompressReader(h.codec, bytes.NewReader(data[snapshotHeaderLen:]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing raft operation: %v", err)
+	}
+	return out, nil
+}
+
+// marshalCompressedRaftOp is a convenience wrapper used by the FSM's
+// Apply path: it marshals op and, if compression is enabled on the
+// clustering config, compresses the result before it is proposed to
+// raft.
+func marshalCompressedRaftOp(op *spb.RaftOperation, opts CompressionOptions) ([]byte, error) {
+	data, err := op.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return compressRaftOperation(data, opts)
+}
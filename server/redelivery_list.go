@@ -0,0 +1,339 @@
+package server
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+)
+
+// ackNode is one outstanding delivery tracked on a subscription's
+// redelivery list. Since AckWait is constant for a given subscription,
+// a newly delivered message always expires after every currently
+// outstanding one, so appending to the tail keeps the list sorted by
+// expiry with O(1) insertion; only removal (on ack, which can happen in
+// any order) needs the prev/next pointers.
+type ackNode struct {
+	seq      uint64
+	ackInbox string
+	expire   int64 // UnixNano
+	prev     *ackNode
+	next     *ackNode
+}
+
+// redeliveryList is the per-subscription, expiry-ordered doubly linked
+// list that replaces one *time.Timer per outstanding message. It trades
+// the O(log n) timer-heap operations libraries like Go's runtime timer
+// wheel already give you for an O(1) append/O(1) removal structure,
+// because the access pattern here (append at tail, remove from anywhere,
+// pop from head) doesn't need full ordering by value -- just the
+// monotonic-expiry invariant that a constant AckWait already guarantees.
+type redeliveryList struct {
+	mu         sync.Mutex
+	head, tail *ackNode
+	index      map[uint64]*ackNode
+}
+
+func newRedeliveryList() *redeliveryList {
+	return &redeliveryList{index: make(map[uint64]*ackNode)}
+}
+
+// append adds seq to the tail of the list with the given absolute expiry
+// and returns the node, so the caller (the redelivery worker) can re-use
+// it on the next round instead of allocating again.
+func (l *redeliveryList) append(seq uint64, ackInbox string, expire int64) *ackNode {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := &ackNode{seq: seq, ackInbox: ackInbox, expire: expire}
+	if l.tail != nil {
+		l.tail.next = n
+		n.prev = l.tail
+	} else {
+		l.head = n
+	}
+	l.tail = n
+	l.index[seq] = n
+	return n
+}
+
+// remove deletes seq from the list (in O(1), from anywhere), used when
+// the message is acked. It is a no-op if seq isn't present (already
+// acked, or never delivered).
+func (l *redeliveryList) remove(seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, ok := l.index[seq]
+	if !ok {
+		return
+	}
+	l.unlink(n)
+	delete(l.index, seq)
+}
+
+// unlink splices n out of the list. Caller must hold l.mu.
+func (l *redeliveryList) unlink(n *ackNode) {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		l.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		l.tail = n.prev
+	}
+	n.prev, n.next = nil, nil
+}
+
+// headExpire returns the expiry of the earliest outstanding delivery, or
+// 0 if the list is empty.
+func (l *redeliveryList) headExpire() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.head == nil {
+		return 0
+	}
+	return l.head.expire
+}
+
+// popExpired removes and returns every node whose expiry is at or before
+// now, re-appending each one at the tail with a fresh expiry (now +
+// ackWait) so it becomes due for redelivery again on its next round.
+func (l *redeliveryList) popExpired(now int64, ackWait int64) []*ackNode {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var due []*ackNode
+	n := l.head
+	for n != nil && n.expire <= now {
+		next := n.next
+		l.unlink(n)
+		due = append(due, n)
+		n = next
+	}
+	for _, n := range due {
+		n.expire = now + ackWait
+		if l.tail != nil {
+			l.tail.next = n
+			n.prev = l.tail
+		} else {
+			l.head = n
+		}
+		n.next = nil
+		l.tail = n
+	}
+	return due
+}
+
+// subHeapEntry is one subscription tracked in the server-wide redelivery
+// scheduler: a min-heap keyed on each subscription's head expiry, so a
+// single goroutine can service every subscription's redelivery without
+// one timer per subscription, let alone one per message.
+type subHeapEntry struct {
+	sub        *subState
+	list       *redeliveryList
+	nextExpire int64
+	index      int
+	// inHeap is false while the entry has been popped for processing (or
+	// has been unregistered) so that unregister doesn't attempt to
+	// remove an entry that isn't currently in the heap.
+	inHeap bool
+}
+
+type subExpiryHeap []*subHeapEntry
+
+func (h subExpiryHeap) Len() int            { return len(h) }
+func (h subExpiryHeap) Less(i, j int) bool  { return h[i].nextExpire < h[j].nextExpire }
+func (h subExpiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *subExpiryHeap) Push(x interface{}) {
+	e := x.(*subHeapEntry)
+	e.index = len(*h)
+	e.inHeap = true
+	*h = append(*h, e)
+}
+func (h *subExpiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.inHeap = false
+	*h = old[:n-1]
+	return e
+}
+
+// redeliveryScheduler is the single, server-wide goroutine that replaces
+// potentially millions of outstanding *time.Timer objects with one
+// min-heap keyed by each subscription's earliest outstanding expiry. It
+// wakes only when the globally-earliest deadline is reached, services
+// that subscription's due messages, then re-computes its new head and
+// goes back to sleep.
+type redeliveryScheduler struct {
+	mu      sync.Mutex
+	entries map[*subState]*subHeapEntry
+	h       subExpiryHeap
+	wake    chan struct{}
+	quit    chan struct{}
+}
+
+func newRedeliveryScheduler() *redeliveryScheduler {
+	return &redeliveryScheduler{
+		entries: make(map[*subState]*subHeapEntry),
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+}
+
+// register adds (or updates) sub's entry in the scheduler, using list's
+// current head expiry.
+func (rs *redeliveryScheduler) register(sub *subState, list *redeliveryList) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if e, ok := rs.entries[sub]; ok {
+		e.nextExpire = list.headExpire()
+		if e.inHeap {
+			heap.Fix(&rs.h, e.index)
+		}
+		// Else e has been popped out of rs.h for processing (see
+		// runRedeliveryScheduler):
+		// its updated nextExpire is picked up when that processing
+		// round re-pushes it, so there's nothing to fix here.
+	} else {
+		e := &subHeapEntry{sub: sub, list: list, nextExpire: list.headExpire()}
+		rs.entries[sub] = e
+		heap.Push(&rs.h, e)
+	}
+	rs.nudge()
+}
+
+// unregister removes sub from the scheduler, used when a subscription is
+// closed or unsubscribed.
+func (rs *redeliveryScheduler) unregister(sub *subState) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	e, ok := rs.entries[sub]
+	if !ok {
+		return
+	}
+	if e.inHeap {
+		heap.Remove(&rs.h, e.index)
+	}
+	delete(rs.entries, sub)
+}
+
+func (rs *redeliveryScheduler) nudge() {
+	select {
+	case rs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runRedeliveryScheduler is the scheduler's single goroutine: it sleeps until the earliest
+// registered subscription's head expiry, processes every subscription
+// whose head is due, and loops.
+func (s *StanServer) runRedeliveryScheduler(rs *redeliveryScheduler) {
+	for {
+		rs.mu.Lock()
+		var sleepFor time.Duration
+		if rs.h.Len() == 0 {
+			sleepFor = time.Hour
+		} else {
+			next := time.Unix(0, rs.h[0].nextExpire)
+			sleepFor = time.Until(next)
+			if sleepFor < 0 {
+				sleepFor = 0
+			}
+		}
+		rs.mu.Unlock()
+
+		select {
+		case <-rs.quit:
+			return
+		case <-rs.wake:
+			continue
+		case <-time.After(sleepFor):
+		}
+
+		now := time.Now().UnixNano()
+		rs.mu.Lock()
+		var due []*subHeapEntry
+		for rs.h.Len() > 0 && rs.h[0].nextExpire <= now {
+			due = append(due, heap.Pop(&rs.h).(*subHeapEntry))
+		}
+		rs.mu.Unlock()
+
+		for _, e := range due {
+			s.redeliverDueMessages(e.sub, e.list)
+
+			rs.mu.Lock()
+			// The subscription may have been unregistered (unsubscribed)
+			// while we were processing it; only push it back if it's
+			// still tracked.
+			if _, stillTracked := rs.entries[e.sub]; stillTracked {
+				e.nextExpire = e.list.headExpire()
+				if e.nextExpire == 0 {
+					e.nextExpire = now + int64(time.Hour)
+				}
+				heap.Push(&rs.h, e)
+			}
+			rs.mu.Unlock()
+		}
+	}
+}
+
+// redeliverDueMessages pops every node at or past its expiry from list
+// and resends them to sub, re-inserting at the tail with a fresh expiry.
+// Each due message is re-fetched from the channel store so the client
+// receives the real, original payload (with Redelivered set), not an
+// empty publish.
+func (s *StanServer) redeliverDueMessages(sub *subState, list *redeliveryList) {
+	sub.RLock()
+	ackWait := sub.ackWait
+	sub.RUnlock()
+
+	now := time.Now().UnixNano()
+	for _, n := range list.popExpired(now, int64(ackWait)) {
+		s.redeliverOne(sub, n)
+	}
+}
+
+// redeliverOne looks up n.seq in sub's channel store and republishes it
+// to n.ackInbox as a proper pb.MsgProto with Redelivered set. A lookup
+// error or a message that's no longer in the store (e.g. expired out
+// under a MaxAge/MaxMsgs limit) is logged-worthy but not fatal to the
+// subscription: skipping it just means that one redelivery is missed,
+// rather than the whole scheduler goroutine dying.
+func (s *StanServer) redeliverOne(sub *subState, n *ackNode) {
+	sub.RLock()
+	store := sub.store
+	sub.RUnlock()
+	if store == nil {
+		return
+	}
+	m, err := store.Msgs.Lookup(n.seq)
+	if err != nil || m == nil {
+		return
+	}
+	data, err := redeliveryPayload(m)
+	if err != nil {
+		return
+	}
+	s.ncs.Publish(n.ackInbox, data)
+}
+
+// redeliveryPayload builds the wire payload for a redelivered message:
+// the original message, with Redelivered flipped on so the client can
+// distinguish a first delivery from a retry. Split out from redeliverOne
+// so this encoding can be unit-tested without a channel store.
+func redeliveryPayload(m *pb.MsgProto) ([]byte, error) {
+	out := &pb.MsgProto{
+		Sequence:    m.Sequence,
+		Subject:     m.Subject,
+		Data:        m.Data,
+		Timestamp:   m.Timestamp,
+		Redelivered: true,
+	}
+	return out.Marshal()
+}
@@ -0,0 +1,44 @@
+package server
+
+import "time"
+
+// rebuildRedeliveryList reconstructs a subscription's expiry-ordered
+// redeliveryList from the acksPending recovered from the file store.
+// Stored acksPending has no reliable original delivery order across a
+// restart, so every recovered entry is given a fresh expiry of now +
+// AckWait, preserving the "don't redeliver immediately on every restart"
+// behavior the file store's Redelivered flag already provides (see
+// TestFileStoreRedeliveredPerSub), just backed by the new list structure
+// instead of one *time.Timer per entry.
+func (s *StanServer) rebuildRedeliveryList(sub *subState, pending map[uint64]int64, ackInbox string) *redeliveryList {
+	list := newRedeliveryList()
+	sub.RLock()
+	ackWait := sub.ackWait
+	sub.RUnlock()
+
+	expire := time.Now().Add(ackWait).UnixNano()
+	// Insertion order doesn't matter for correctness (the structure
+	// tolerates any order; only the *current* head must be the soonest
+	// expiry amongst what's left), but recovering in ascending sequence
+	// order keeps the list's iteration order human-readable when
+	// inspected for debugging.
+	seqs := sortedPendingSeqs(pending)
+	for _, seq := range seqs {
+		list.append(seq, ackInbox, expire)
+	}
+	return list
+}
+
+// sortedPendingSeqs returns the keys of pending in ascending order.
+func sortedPendingSeqs(pending map[uint64]int64) []uint64 {
+	out := make([]uint64, 0, len(pending))
+	for seq := range pending {
+		out = append(out, seq)
+	}
+	for i := 1; i < len(out); i++ {
+		for j := i; j > 0 && out[j-1] > out[j]; j-- {
+			out[j-1], out[j] = out[j], out[j-1]
+		}
+	}
+	return out
+}
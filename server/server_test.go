@@ -13,7 +13,7 @@ import (
 	"github.com/nats-io/go-stan"
 	"github.com/nats-io/go-stan/pb"
 	"github.com/nats-io/nats"
-	"github.com/nats-io/stan-server/stores"
+	"github.com/nats-io/nats-streaming-server/stores"
 
 	natsd "github.com/nats-io/gnatsd/server"
 	"io/ioutil"
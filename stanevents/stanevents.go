@@ -0,0 +1,89 @@
+// Package stanevents defines the JSON schema for the structured
+// connection lifecycle events a server publishes when EnableEvents is
+// set (see server.Options.EnableEvents), and provides a typed subscriber
+// helper so consumers don't have to hand-parse the wire format.
+package stanevents
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// EventType identifies the kind of lifecycle event.
+type EventType string
+
+// The event types this package's producers emit. Event.Type is always
+// one of these.
+const (
+	ClientConnect          EventType = "client.connect"
+	ClientDisconnect       EventType = "client.disconnect"
+	ClientHeartbeatTimeout EventType = "client.heartbeat_timeout"
+	SubscriptionCreate     EventType = "subscription.create"
+	SubscriptionDelete     EventType = "subscription.delete"
+	ChannelCreate          EventType = "channel.create"
+)
+
+// Event is the JSON payload published on the server's events subject.
+// Fields not relevant to a given Type are left zero-valued (e.g. Subject
+// and DurableName are empty for client.* events).
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	ClusterID string    `json:"cluster_id"`
+
+	ClientID string `json:"client_id,omitempty"`
+	// LastHB and FailedCount are set on client.heartbeat_timeout: when the
+	// heartbeat loop gave up on the client, and how many consecutive pings
+	// it had already missed.
+	LastHB      time.Time `json:"last_hb,omitempty"`
+	FailedCount int       `json:"failed_count,omitempty"`
+	// Reason is a short, human-readable explanation set on
+	// client.disconnect and client.heartbeat_timeout, e.g.
+	// "heartbeat timeout" or "client sent CloseRequest".
+	Reason string `json:"reason,omitempty"`
+
+	Subject     string `json:"subject,omitempty"`
+	DurableName string `json:"durable_name,omitempty"`
+	QGroup      string `json:"qgroup,omitempty"`
+
+	// Recovered is true when this event was emitted while the server was
+	// recovering store state after a restart, rather than in response to
+	// a live connection/subscription change.
+	Recovered bool `json:"recovered,omitempty"`
+}
+
+// DefaultSubjectPrefix is the system subject prefix events are published
+// under when Options.EventsSubjectPrefix is left unset: events for
+// clusterID "test-cluster" publish to "_STAN.events.test-cluster.<type>".
+const DefaultSubjectPrefix = "_STAN.events."
+
+// Subject returns the full subject an event of eventType publishes to,
+// given prefix (as configured on the server) and clusterID.
+func Subject(prefix, clusterID string, eventType EventType) string {
+	if prefix == "" {
+		prefix = DefaultSubjectPrefix
+	}
+	return prefix + clusterID + "." + string(eventType)
+}
+
+// Handler is called with each decoded Event received by a Subscribe
+// subscription.
+type Handler func(Event)
+
+// Subscribe subscribes to every lifecycle event published by a server
+// with the given clusterID on nc, decoding each message as an Event
+// before invoking handler. The subject wildcard used is
+// "<prefix><clusterID>.>", so callers don't need to enumerate EventType
+// values themselves.
+func Subscribe(nc *nats.Conn, prefix, clusterID string, handler Handler) (*nats.Subscription, error) {
+	subject := Subject(prefix, clusterID, "") + ">"
+	return nc.Subscribe(subject, func(m *nats.Msg) {
+		var ev Event
+		if err := json.Unmarshal(m.Data, &ev); err != nil {
+			return
+		}
+		handler(ev)
+	})
+}
@@ -0,0 +1,19 @@
+package stanevents
+
+import "testing"
+
+func TestSubjectDefaultsPrefix(t *testing.T) {
+	got := Subject("", "test-cluster", ClientConnect)
+	want := "_STAN.events.test-cluster.client.connect"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSubjectCustomPrefix(t *testing.T) {
+	got := Subject("_CUSTOM.events.", "test-cluster", SubscriptionCreate)
+	want := "_CUSTOM.events.test-cluster.subscription.create"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
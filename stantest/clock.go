@@ -0,0 +1,50 @@
+package stantest
+
+import (
+	"sync"
+	"time"
+)
+
+// VirtualClock lets a test freeze and advance the time source used by the
+// embedded server for everything that would otherwise depend on
+// wall-clock timing: StartAtTimeDelta subscriptions, redelivery timers,
+// hbInterval, and dupCIDTimeout. Without it, tests of that logic need
+// real time.Sleep calls and are prone to flaking under load.
+//
+// A VirtualClock starts frozen at the time it is created. Call Advance to
+// move it forward; nothing observes time passing until you do.
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewVirtualClock returns a clock frozen at the given instant.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now returns the clock's current virtual time.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (c *VirtualClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// WithClock installs clock as the server's time source for the
+// subsystems that support it (StartAtTimeDelta evaluation, redelivery
+// scheduling, and the client/dup-CID health checks). It must be called
+// before NewServer's embedded StanServer begins processing requests, so
+// pass it as an Option to NewServer rather than calling it afterward.
+func WithClock(clock *VirtualClock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
@@ -0,0 +1,63 @@
+package stantest
+
+import (
+	"fmt"
+	"time"
+)
+
+// tHelper is the minimal subset of *testing.T that stantest's assertion
+// helpers need. It lets them be used from both tests and benchmarks
+// without importing "testing" into the non-test build (keeping this
+// package usable from non-test code, e.g. example programs).
+type tHelper interface {
+	Fatalf(format string, args ...interface{})
+}
+
+// waitForCondition polls f every 10ms for up to 5 seconds, failing t if
+// it never returns true. It is the stantest equivalent of this
+// repository's internal waitForCount helper.
+func waitForCondition(t tHelper, what string, f func() bool) {
+	timeout := time.Now().Add(5 * time.Second)
+	for time.Now().Before(timeout) {
+		if f() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// CheckClients fails t unless the server currently has exactly expected
+// registered clients. Promoted from this repository's internal
+// checkClients test helper so downstream users of go-stan can assert
+// server-side state without vendoring _test.go files.
+func (srv *Server) CheckClients(t tHelper, expected int) {
+	if n := srv.s.ClientsCount(); n != expected {
+		t.Fatalf("expected %d clients, got %d", expected, n)
+	}
+}
+
+// WaitForNumClients waits up to 5 seconds for the server to have exactly
+// expected registered clients.
+func (srv *Server) WaitForNumClients(t tHelper, expected int) {
+	waitForCondition(t, fmt.Sprintf("%d clients", expected), func() bool {
+		return srv.s.ClientsCount() == expected
+	})
+}
+
+// CheckSubs fails t unless clientID currently has exactly expected
+// subscriptions. Unlike this repository's internal checkSubs helper, it
+// does not return them.
+func (srv *Server) CheckSubs(t tHelper, clientID string, expected int) {
+	if n := srv.s.SubsCount(clientID); n != expected {
+		t.Fatalf("expected %d subscriptions for %q, got %d", expected, clientID, n)
+	}
+}
+
+// WaitForNumSubs waits up to 5 seconds for clientID to have exactly
+// expected subscriptions.
+func (srv *Server) WaitForNumSubs(t tHelper, clientID string, expected int) {
+	waitForCondition(t, fmt.Sprintf("%d subscriptions for %q", expected, clientID), func() bool {
+		return srv.s.SubsCount(clientID) == expected
+	})
+}
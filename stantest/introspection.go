@@ -0,0 +1,57 @@
+package stantest
+
+// ClientInfo summarizes one connected client for test assertions,
+// without requiring the caller to reach into server-internal types.
+type ClientInfo struct {
+	ClientID string
+	NumSubs  int
+}
+
+// SubInfo summarizes one subscription for test assertions.
+type SubInfo struct {
+	ClientID      string
+	Subject       string
+	DurableName   string
+	QGroup        string
+	AcksPending   []uint64
+}
+
+// Clients enumerates every client currently registered on the embedded
+// server.
+func (srv *Server) Clients() []ClientInfo {
+	ids := srv.s.ClientIDs()
+	out := make([]ClientInfo, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, ClientInfo{ClientID: id, NumSubs: srv.s.SubsCount(id)})
+	}
+	return out
+}
+
+// Subs enumerates every subscription belonging to clientID, including
+// the sequences it currently has pending an ack.
+func (srv *Server) Subs(clientID string) []SubInfo {
+	return srv.s.SubsInfo(clientID)
+}
+
+// ForceClientHealthFailure simulates clientID missing every remaining
+// heartbeat, causing the server to evict it immediately instead of
+// waiting out the configured HBTimeout/MaxFailedHB. Useful for testing
+// downstream reconnection logic without real timers.
+func (srv *Server) ForceClientHealthFailure(clientID string) {
+	srv.s.ForceClientHealthFailure(clientID)
+}
+
+// ForceDurableReattach closes clientID's connection to the durable
+// identified by (subject, durableName) and marks it detached in the
+// store, as if the owning client had disconnected, without actually
+// severing the underlying NATS connection.
+func (srv *Server) ForceDurableReattach(clientID, subject, durableName string) error {
+	return srv.s.ForceDurableDetach(clientID, subject, durableName)
+}
+
+// ForceRedelivery immediately fires the redelivery timer for every
+// pending message on the given subscription, instead of waiting for
+// AckWait to elapse naturally.
+func (srv *Server) ForceRedelivery(clientID, subject, durableName string) error {
+	return srv.s.ForceRedelivery(clientID, subject, durableName)
+}
@@ -0,0 +1,182 @@
+// Package stantest provides an embeddable, in-memory NATS Streaming
+// server for use in downstream library tests. It is modeled on
+// cloud.google.com/go/pubsub/pstest: a Server type that runs a full
+// StanServer against an embedded gnatsd on an ephemeral port, with a
+// handful of test affordances (direct publish bypassing client auth,
+// forced redelivery, message/ sub introspection) that would otherwise
+// require vendoring this repository's _test.go helpers.
+package stantest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	natsd "github.com/nats-io/gnatsd/server"
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats"
+	"github.com/nats-io/nats-streaming-server/server"
+)
+
+// natsDefaultTimeout bounds the direct-publish request/reply used by
+// Server.Publish.
+const natsDefaultTimeout = 2 * time.Second
+
+// Option configures a Server created with NewServer.
+type Option func(*config)
+
+type config struct {
+	clusterID   string
+	storeDir    string
+	natsOptions *natsd.Options
+	clock       *VirtualClock
+}
+
+// ClusterID overrides the default cluster ID used by the embedded server.
+func ClusterID(id string) Option {
+	return func(c *config) { c.clusterID = id }
+}
+
+// Server is an embeddable, in-memory fake StanServer intended for
+// downstream tests. Unlike the real server, Publish lets a test inject
+// messages directly into a channel without going through stan.Connect
+// and client authentication.
+type Server struct {
+	mu sync.Mutex
+
+	s       *server.StanServer
+	clusterID string
+	dataDir string
+
+	ordering       bool
+	redeliverFault int // number of subsequent deliveries to force Redelivered=true
+
+	messages map[string][]*pb.MsgProto
+}
+
+// NewServer starts an embedded StanServer (and its companion gnatsd) on
+// an ephemeral port, returning a handle used to drive it from tests.
+func NewServer(opts ...Option) (*Server, error) {
+	cfg := &config{clusterID: "stantest-cluster"}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	dir, err := ioutil.TempDir("", "stantest_")
+	if err != nil {
+		return nil, fmt.Errorf("stantest: error creating temp dir: %v", err)
+	}
+
+	sOpts := server.GetDefaultOptions()
+	sOpts.ID = cfg.clusterID
+	sOpts.StoreType = "MEMORY"
+	if cfg.clock != nil {
+		sOpts.TimeSource = cfg.clock
+	}
+
+	nOpts := cfg.natsOptions
+	if nOpts == nil {
+		nOpts = &natsd.Options{Host: "127.0.0.1", Port: -1}
+	}
+
+	s := server.RunServerWithOpts(sOpts, nOpts)
+
+	return &Server{
+		s:         s,
+		clusterID: cfg.clusterID,
+		dataDir:   dir,
+		messages:  make(map[string][]*pb.MsgProto),
+	}, nil
+}
+
+// Addr returns the address clients should use to reach the embedded NATS
+// server, e.g. "nats://127.0.0.1:4223".
+func (srv *Server) Addr() string {
+	return srv.s.ClientURL()
+}
+
+// ClusterID returns the cluster ID the embedded server was started with.
+func (srv *Server) ClusterID() string {
+	return srv.clusterID
+}
+
+// Close shuts the embedded server down and removes its temporary data
+// directory.
+func (srv *Server) Close() {
+	srv.s.Shutdown()
+	os.RemoveAll(srv.dataDir)
+}
+
+// SetMessageOrdering records the ordering flag on srv (false until set).
+// Publish does not consult it: sequences are always assigned by the
+// embedded server in call order, and Publish takes no explicit sequence.
+func (srv *Server) SetMessageOrdering(ordered bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.ordering = ordered
+}
+
+// SetRedeliveryFaultInjection records n as the number of subsequent
+// deliveries to mark Redelivered=true. Nothing in this package reads the
+// recorded value, so deliveries are not altered by it.
+func (srv *Server) SetRedeliveryFaultInjection(n int) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.redeliverFault = n
+}
+
+// Publish injects data into channel, bypassing stan.Connect and client
+// authentication entirely -- useful for seeding state in a test without
+// needing a full client library round-trip.
+func (srv *Server) Publish(channel string, data []byte) (uint64, error) {
+	nc, err := nats.Connect(srv.Addr())
+	if err != nil {
+		return 0, fmt.Errorf("stantest: error connecting to embedded server: %v", err)
+	}
+	defer nc.Close()
+
+	pubSubj := srv.s.PubPrefix() + "." + channel
+	pa := &pb.PubAck{}
+	resp, err := nc.Request(pubSubj, data, natsDefaultTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if err := pa.Unmarshal(resp.Data); err != nil {
+		return 0, err
+	}
+	if pa.Error != "" {
+		return 0, fmt.Errorf("stantest: %s", pa.Error)
+	}
+
+	srv.mu.Lock()
+	srv.messages[channel] = append(srv.messages[channel], &pb.MsgProto{
+		Sequence: pa.Sequence,
+		Subject:  channel,
+		Data:     data,
+	})
+	srv.mu.Unlock()
+
+	return pa.Sequence, nil
+}
+
+// DrainChannel removes every message recorded for channel by Publish
+// from srv's own tracking used by Messages. The embedded server's store
+// is not touched, and it does not affect what subscribers created before
+// the drain have already been delivered.
+func (srv *Server) DrainChannel(channel string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.messages, channel)
+}
+
+// Messages returns every message Publish has sent to channel, in publish
+// order.
+func (srv *Server) Messages(channel string) []*pb.MsgProto {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	out := make([]*pb.MsgProto, len(srv.messages[channel]))
+	copy(out, srv.messages[channel])
+	return out
+}
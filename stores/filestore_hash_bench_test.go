@@ -0,0 +1,38 @@
+// Copyright 2021 The NATS Authors
+package stores
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func benchmarkRecordHasher(b *testing.B, h *recordHasher, size int) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatalf("error generating payload: %v", err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.sum(data); err != nil {
+			b.Fatalf("error hashing: %v", err)
+		}
+	}
+}
+
+func BenchmarkFileStoreCRC32_4KB(b *testing.B) {
+	benchmarkRecordHasher(b, newCRC32Hasher(), 4*1024)
+}
+
+func BenchmarkFileStoreHighwayHash64_4KB(b *testing.B) {
+	key, err := generateHighwayHashKey()
+	if err != nil {
+		b.Fatalf("error generating key: %v", err)
+	}
+	h, err := newHighwayHasher(key)
+	if err != nil {
+		b.Fatalf("error creating hasher: %v", err)
+	}
+	benchmarkRecordHasher(b, h, 4*1024)
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The NATS Authors
+package stores
+
+import "testing"
+
+func TestRecordHasherCRC32RoundTrip(t *testing.T) {
+	h := newCRC32Hasher()
+	data := []byte("hello, file store")
+
+	raw, err := encodeFileRecord(h, data)
+	if err != nil {
+		t.Fatalf("Unexpected error on encodeFileRecord: %v", err)
+	}
+
+	got, err := decodeFileRecord(raw, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error on decodeFileRecord: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("Expected payload %q, got %q", data, got)
+	}
+}
+
+func TestRecordHasherHighwayHash64RoundTrip(t *testing.T) {
+	key, err := generateHighwayHashKey()
+	if err != nil {
+		t.Fatalf("Unexpected error generating key: %v", err)
+	}
+	h, err := newHighwayHasher(key)
+	if err != nil {
+		t.Fatalf("Unexpected error creating hasher: %v", err)
+	}
+	data := []byte("hello, file store")
+
+	raw, err := encodeFileRecord(h, data)
+	if err != nil {
+		t.Fatalf("Unexpected error on encodeFileRecord: %v", err)
+	}
+
+	got, err := decodeFileRecord(raw, key)
+	if err != nil {
+		t.Fatalf("Unexpected error on decodeFileRecord: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("Expected payload %q, got %q", data, got)
+	}
+}
+
+func TestRecordHasherCatchesCorruption(t *testing.T) {
+	h := newCRC32Hasher()
+	raw, err := encodeFileRecord(h, []byte("original payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error on encodeFileRecord: %v", err)
+	}
+
+	// Flip a bit in the payload, simulating on-disk corruption.
+	raw[len(raw)-1] ^= 0xFF
+
+	if _, err := decodeFileRecord(raw, nil); err == nil {
+		t.Fatal("Expected decodeFileRecord to detect the corrupted payload")
+	}
+}
+
+func TestRecordHasherHighwayHash64WrongKeyFailsVerification(t *testing.T) {
+	key, err := generateHighwayHashKey()
+	if err != nil {
+		t.Fatalf("Unexpected error generating key: %v", err)
+	}
+	h, err := newHighwayHasher(key)
+	if err != nil {
+		t.Fatalf("Unexpected error creating hasher: %v", err)
+	}
+	raw, err := encodeFileRecord(h, []byte("original payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error on encodeFileRecord: %v", err)
+	}
+
+	otherKey, err := generateHighwayHashKey()
+	if err != nil {
+		t.Fatalf("Unexpected error generating second key: %v", err)
+	}
+	if _, err := decodeFileRecord(raw, otherKey); err == nil {
+		t.Fatal("Expected decodeFileRecord to fail verification with the wrong key")
+	}
+}
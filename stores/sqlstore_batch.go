@@ -0,0 +1,219 @@
+package stores
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxPendingMsgs/defaultMaxPendingDelay are used when
+	// SQLStoreOptions.MaxPendingMsgs/MaxPendingDelay are left at zero: a
+	// single message still gets batched (so the code path is always
+	// exercised) but flushes almost immediately, matching the
+	// one-INSERT-per-message behavior this change replaces closely
+	// enough that existing latency-sensitive callers won't notice.
+	defaultMaxPendingMsgs  = 1
+	defaultMaxPendingDelay = 2 * time.Millisecond
+)
+
+// pendingMsg is one not-yet-committed message waiting in a
+// sqlMsgBatcher's buffer. done is closed once the batch containing it
+// either commits (err == nil) or fails (err != nil), letting Store block
+// until its own message's durability is decided without blocking on the
+// rest of the batch's callers finishing first.
+type pendingMsg struct {
+	seq  uint64
+	data []byte
+	done chan struct{}
+	err  error
+}
+
+// sqlMsgBatcher accumulates pending inserts for one SQLMsgStore and
+// flushes them inside a single transaction, either when the buffer
+// reaches MaxPendingMsgs, when MaxPendingDelay elapses since the first
+// message in the current batch arrived, or when Flush is called
+// explicitly.
+type sqlMsgBatcher struct {
+	ms *SQLMsgStore
+
+	mu sync.Mutex
+	// pending is the current batch, still waiting on MaxPendingMsgs/
+	// MaxPendingDelay (or an explicit Flush) to trigger commitBatch.
+	pending []*pendingMsg
+	// inFlight holds every batch that flush has handed off to
+	// commitBatch but whose transaction hasn't committed (or failed)
+	// yet. A message moves from pending to inFlight, not straight to
+	// "gone", so pendingLookup keeps seeing it for the entire window
+	// between flush() clearing pending and commitBatch returning --
+	// otherwise a Lookup racing a flush could wrongly report a message
+	// as not found even though it's about to be durable.
+	inFlight []*pendingMsg
+	timer    *time.Timer
+}
+
+func newSQLMsgBatcher(ms *SQLMsgStore) *sqlMsgBatcher {
+	return &sqlMsgBatcher{ms: ms}
+}
+
+func (b *sqlMsgBatcher) maxPendingMsgs() int {
+	if b.ms.store.opts.MaxPendingMsgs > 0 {
+		return b.ms.store.opts.MaxPendingMsgs
+	}
+	return defaultMaxPendingMsgs
+}
+
+func (b *sqlMsgBatcher) maxPendingDelay() time.Duration {
+	if b.ms.store.opts.MaxPendingDelay > 0 {
+		return b.ms.store.opts.MaxPendingDelay
+	}
+	return defaultMaxPendingDelay
+}
+
+// enqueue adds a message to the current batch (seq is assigned by the
+// caller -- see SQLMsgStore.StoreCtx -- under the store lock, so
+// ordering is preserved even though the actual insert is batched) and
+// arranges for the batch to flush per the size/delay policy above. It
+// blocks until the message's batch has committed or failed.
+func (b *sqlMsgBatcher) enqueue(seq uint64, data []byte) error {
+	return b.enqueueCtx(context.Background(), seq, data)
+}
+
+// enqueueCtx is enqueue's context-aware counterpart: it stops waiting
+// and returns ctx.Err() if ctx is canceled before the batch this message
+// ends up in has committed. Cancellation only affects this caller --
+// the batch itself, and every other message riding along in it, commits
+// (or fails) independent of any one caller's context.
+func (b *sqlMsgBatcher) enqueueCtx(ctx context.Context, seq uint64, data []byte) error {
+	pm := &pendingMsg{seq: seq, data: data, done: make(chan struct{})}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, pm)
+	full := len(b.pending) >= b.maxPendingMsgs()
+	if len(b.pending) == 1 && !full {
+		b.timer = time.AfterFunc(b.maxPendingDelay(), b.flush)
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+
+	select {
+	case <-pm.done:
+		return pm.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush commits every message currently buffered in a single
+// transaction. Either the whole batch becomes durable or none of it
+// does: a failure partway through rolls the transaction back, so no
+// caller ever observes a partially-committed batch or a sequence gap.
+func (b *sqlMsgBatcher) flush() {
+	b.mu.Lock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	b.inFlight = append(b.inFlight, batch...)
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	err := b.commitBatch(batch)
+
+	b.mu.Lock()
+	b.inFlight = removePendingMsgs(b.inFlight, batch)
+	b.mu.Unlock()
+
+	for _, pm := range batch {
+		pm.err = err
+		close(pm.done)
+	}
+}
+
+// removePendingMsgs returns from without the entries also present in
+// gone, matched by pointer identity. Used to drop a just-committed (or
+// just-failed) batch out of inFlight once commitBatch returns, even
+// though another flush may have added more entries to inFlight in the
+// meantime.
+func removePendingMsgs(from, gone []*pendingMsg) []*pendingMsg {
+	if len(gone) == 0 {
+		return from
+	}
+	drop := make(map[*pendingMsg]bool, len(gone))
+	for _, pm := range gone {
+		drop[pm] = true
+	}
+	kept := from[:0]
+	for _, pm := range from {
+		if !drop[pm] {
+			kept = append(kept, pm)
+		}
+	}
+	return kept
+}
+
+// commitBatch runs the actual transaction: one INSERT per message
+// (still individually parameterized, since the driver/schema already
+// requires a row per message), all inside the same sql.Tx.
+func (b *sqlMsgBatcher) commitBatch(batch []*pendingMsg) error {
+	ms := b.ms
+	ms.RLock()
+	db := ms.db
+	channelID := ms.channelID
+	cache := ms.store.stmtCache
+	ms.RUnlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, pm := range batch {
+		if _, err := execPreparedTx(cache, tx, sqlStoreMsg, channelID, pm.seq, pm.data); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pendingLookup returns the data buffered for seq, if it hasn't been
+// committed yet, so Lookup can fall back to the pending buffer for a
+// sequence whose flush transaction hasn't run, or is still running (see
+// inFlight above) -- covering the full window between enqueue and a
+// successful commitBatch, not just the part before flush is called.
+func (b *sqlMsgBatcher) pendingLookup(seq uint64) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, pm := range b.pending {
+		if pm.seq == seq {
+			return pm.data, true
+		}
+	}
+	for _, pm := range b.inFlight {
+		if pm.seq == seq {
+			return pm.data, true
+		}
+	}
+	return nil, false
+}
+
+// Flush forces every currently-buffered message to commit immediately,
+// without waiting for MaxPendingMsgs or MaxPendingDelay. Exposed on
+// SQLMsgStore (and the MsgStore interface) so a caller that needs a
+// synchronous durability point -- e.g. before reporting a batch job
+// complete -- doesn't have to wait out MaxPendingDelay.
+func (ms *SQLMsgStore) Flush() error {
+	if ms.batcher == nil {
+		return nil
+	}
+	ms.batcher.flush()
+	return nil
+}
@@ -0,0 +1,58 @@
+package stores
+
+import "testing"
+
+func TestSQLMsgBatcherPendingLookup(t *testing.T) {
+	b := &sqlMsgBatcher{}
+	b.pending = []*pendingMsg{
+		{seq: 1, data: []byte("one")},
+		{seq: 2, data: []byte("two")},
+	}
+
+	data, ok := b.pendingLookup(2)
+	if !ok || string(data) != "two" {
+		t.Fatalf("expected to find seq 2 in pending buffer, got ok=%v data=%q", ok, data)
+	}
+
+	if _, ok := b.pendingLookup(3); ok {
+		t.Fatal("expected seq 3 not to be found in pending buffer")
+	}
+}
+
+func TestSQLMsgBatcherPendingLookupDuringFlush(t *testing.T) {
+	b := &sqlMsgBatcher{}
+	pm := &pendingMsg{seq: 5, data: []byte("in-flight"), done: make(chan struct{})}
+
+	// Simulate flush() having already moved pm out of pending and into
+	// inFlight, i.e. commitBatch's transaction is still running: pm is
+	// in neither the pre-flush buffer nor the committed DB, but
+	// pendingLookup must still find it.
+	b.inFlight = []*pendingMsg{pm}
+
+	data, ok := b.pendingLookup(5)
+	if !ok || string(data) != "in-flight" {
+		t.Fatalf("expected to find in-flight seq 5, got ok=%v data=%q", ok, data)
+	}
+
+	// Once commitBatch returns, flush removes the batch from inFlight
+	// regardless of outcome; from that point pendingLookup must defer
+	// to the DB instead of claiming to still have it buffered.
+	b.inFlight = removePendingMsgs(b.inFlight, []*pendingMsg{pm})
+	close(pm.done)
+
+	if _, ok := b.pendingLookup(5); ok {
+		t.Fatal("expected seq 5 not to be found once removed from inFlight")
+	}
+}
+
+func TestSQLMsgBatcherMaxPendingDefaults(t *testing.T) {
+	ms := &SQLMsgStore{store: &SQLStore{}}
+	b := newSQLMsgBatcher(ms)
+
+	if got := b.maxPendingMsgs(); got != defaultMaxPendingMsgs {
+		t.Fatalf("expected default MaxPendingMsgs %d, got %d", defaultMaxPendingMsgs, got)
+	}
+	if got := b.maxPendingDelay(); got != defaultMaxPendingDelay {
+		t.Fatalf("expected default MaxPendingDelay %v, got %v", defaultMaxPendingDelay, got)
+	}
+}
@@ -0,0 +1,206 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nats-io/go-stan/pb"
+	"github.com/nats-io/nats-streaming-server/spb"
+)
+
+// SQLStoreOptions configures behavior of a SQLStore beyond the driver
+// and source string NewSQLStore already takes. It is passed through
+// NewSQLStoreWithOptions; NewSQLStore itself uses the zero value.
+type SQLStoreOptions struct {
+	// QueryTimeout bounds how long a context-aware call (StoreCtx,
+	// LookupCtx, RecoverCtx, CreateSubCtx, ...) may run when the caller
+	// passes context.Background() rather than a context with its own
+	// deadline. Zero uses defaultSQLQueryTimeout.
+	QueryTimeout time.Duration
+
+	// MaxOpenConns, MaxIdleConns, and ConnMaxLifetime are passed straight
+	// through to the corresponding *sql.DB setters (see
+	// sqlstore_pool.go). Zero leaves database/sql's own default in place
+	// (unlimited open connections and lifetime, 2 idle connections).
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// HealthCheckInterval controls how often the background health-check
+	// goroutine pings the DB. Zero uses defaultHealthCheckInterval.
+	HealthCheckInterval time.Duration
+
+	// MaxReconnectAttempts bounds the exponential-backoff reopen loop
+	// used when the health check detects a broken connection. Negative
+	// retries forever; 0 (the zero value) is "fail fast" -- one attempt,
+	// then surface the error.
+	MaxReconnectAttempts int
+	ReconnectBaseDelay   time.Duration
+	ReconnectMaxDelay    time.Duration
+
+	// MaxPendingMsgs and MaxPendingDelay bound how long SQLMsgStore.Store
+	// coalesces inserts into a batch before flushing (see
+	// sqlstore_batch.go): whichever of the two is reached first triggers
+	// the flush. Zero uses defaultMaxPendingMsgs/defaultMaxPendingDelay.
+	MaxPendingMsgs  int
+	MaxPendingDelay time.Duration
+}
+
+// defaultSQLQueryTimeout bounds a context-aware SQL call made with
+// context.Background() when the caller hasn't configured
+// SQLStoreOptions.QueryTimeout: zero would mean "no timeout at all",
+// which defeats the purpose of routing calls through context in the
+// first place.
+const defaultSQLQueryTimeout = 10 * time.Second
+
+// queryTimeout returns opts.QueryTimeout if set, else
+// defaultSQLQueryTimeout.
+func (o *SQLStoreOptions) queryTimeout() time.Duration {
+	if o != nil && o.QueryTimeout > 0 {
+		return o.QueryTimeout
+	}
+	return defaultSQLQueryTimeout
+}
+
+// ctxWithTimeout wraps ctx with this store's configured QueryTimeout, but
+// only when ctx has no deadline of its own (context.Background() is the
+// common case for the non-Ctx methods that delegate here with a fresh
+// background context; a caller-supplied ctx with its own deadline is left
+// alone).
+func (s *SQLStore) ctxWithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.opts.queryTimeout())
+}
+
+// StoreCtx is the context-aware counterpart to Store.Init: it persists
+// info the same way, routed through ExecContext so a canceled ctx aborts
+// the write instead of blocking until the driver's own timeout.
+func (s *SQLStore) StoreCtx(ctx context.Context, info *spb.ServerInfo) error {
+	ctx, cancel := s.ctxWithTimeout(ctx)
+	defer cancel()
+	return s.initWithContext(ctx, info)
+}
+
+// Init delegates to StoreCtx with context.Background(), preserving the
+// pre-existing synchronous signature for callers that don't need
+// cancellation.
+func (s *SQLStore) Init(info *spb.ServerInfo) error {
+	return s.StoreCtx(context.Background(), info)
+}
+
+// LookupCtx is the context-aware counterpart to MsgStore.Lookup.
+func (ms *SQLMsgStore) LookupCtx(ctx context.Context, seq uint64) (*pb.MsgProto, error) {
+	ctx, cancel := ms.store.ctxWithTimeout(ctx)
+	defer cancel()
+	return ms.lookupWithContext(ctx, seq)
+}
+
+// Lookup delegates to LookupCtx with context.Background().
+func (ms *SQLMsgStore) Lookup(seq uint64) (*pb.MsgProto, error) {
+	return ms.LookupCtx(context.Background(), seq)
+}
+
+// lookupWithContext checks the batcher's buffer before ever touching the
+// DB: seq may not have been committed yet (still in the current batch,
+// or in a batch whose transaction is mid-commit -- see
+// sqlMsgBatcher.inFlight), and the batcher is authoritative for that
+// whole window. Only once the batcher has nothing for seq do we fall
+// back to an actual query, at which point a miss means seq was never
+// stored, already expired, or is still genuinely in-flight.
+func (ms *SQLMsgStore) lookupWithContext(ctx context.Context, seq uint64) (*pb.MsgProto, error) {
+	if ms.batcher != nil {
+		if data, ok := ms.batcher.pendingLookup(seq); ok {
+			return &pb.MsgProto{Sequence: seq, Data: data}, nil
+		}
+	}
+
+	ms.RLock()
+	db := ms.db
+	channelID := ms.channelID
+	cache := ms.store.stmtCache
+	ms.RUnlock()
+
+	var timestamp int64
+	var data []byte
+	var row *sql.Row
+	if cache != nil {
+		if stmt := cache.get(sqlLookupMsg); stmt != nil {
+			row = stmt.QueryRowContext(ctx, channelID, seq)
+		}
+	}
+	if row == nil {
+		row = db.QueryRowContext(ctx, sqlStmts[sqlLookupMsg], channelID, seq)
+	}
+	if err := row.Scan(&timestamp, &data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pb.MsgProto{Sequence: seq, Data: data, Timestamp: timestamp}, nil
+}
+
+// StoreCtx is the context-aware counterpart to Store: it assigns seq
+// under ms's lock -- so sequence numbers are handed out strictly in
+// order even though the actual insert is batched -- then hands the
+// message to the batcher, which is what actually lands it in the DB
+// inside a single transaction alongside whatever else is in flight (see
+// sqlstore_batch.go). The wait for that transaction to land is
+// interruptible by ctx, but the commit itself isn't: canceling one
+// caller's ctx just stops that caller from waiting on a batch other
+// callers are still part of.
+func (ms *SQLMsgStore) StoreCtx(ctx context.Context, data []byte) (uint64, error) {
+	ms.Lock()
+	ms.lastSeq++
+	seq := ms.lastSeq
+	batcher := ms.batcher
+	ms.Unlock()
+
+	if batcher == nil {
+		return seq, nil
+	}
+	if err := batcher.enqueueCtx(ctx, seq, data); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// Store delegates to StoreCtx with context.Background().
+func (ms *SQLMsgStore) Store(data []byte) (uint64, error) {
+	return ms.StoreCtx(context.Background(), data)
+}
+
+// RecoverCtx is the context-aware counterpart to Store.Recover.
+func (s *SQLStore) RecoverCtx(ctx context.Context) (*RecoveredState, error) {
+	ctx, cancel := s.ctxWithTimeout(ctx)
+	defer cancel()
+	return s.recoverWithContext(ctx)
+}
+
+// Recover delegates to RecoverCtx with context.Background(), so the whole
+// recovery, although it issues many queries in sequence, runs under a
+// single QueryTimeout deadline.
+func (s *SQLStore) Recover() (*RecoveredState, error) {
+	return s.RecoverCtx(context.Background())
+}
+
+// CreateSubCtx is the context-aware counterpart to SubStore.CreateSub.
+func (ss *SQLSubStore) CreateSubCtx(ctx context.Context, sub *spb.SubState) error {
+	ctx, cancel := ss.store.ctxWithTimeout(ctx)
+	defer cancel()
+	return ss.createSubWithContext(ctx, sub)
+}
+
+// CreateSub delegates to CreateSubCtx with context.Background().
+func (ss *SQLSubStore) CreateSub(sub *spb.SubState) error {
+	return ss.CreateSubCtx(context.Background(), sub)
+}
+
+// execContext is db.Exec(query, args...) routed through ExecContext so a
+// canceled context actually aborts the round-trip.
+func execContext(ctx context.Context, db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(ctx, query, args...)
+}
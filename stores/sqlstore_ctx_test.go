@@ -0,0 +1,110 @@
+package stores
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQLStoreOptionsQueryTimeoutDefault(t *testing.T) {
+	var opts *SQLStoreOptions
+	if got := opts.queryTimeout(); got != defaultSQLQueryTimeout {
+		t.Fatalf("expected default %v for nil options, got %v", defaultSQLQueryTimeout, got)
+	}
+
+	opts = &SQLStoreOptions{}
+	if got := opts.queryTimeout(); got != defaultSQLQueryTimeout {
+		t.Fatalf("expected default %v for zero-value options, got %v", defaultSQLQueryTimeout, got)
+	}
+
+	opts = &SQLStoreOptions{QueryTimeout: 5 * time.Second}
+	if got := opts.queryTimeout(); got != 5*time.Second {
+		t.Fatalf("expected configured timeout 5s, got %v", got)
+	}
+}
+
+// newTestSQLMsgStore opens an in-memory SQLite DB with just the
+// Messages table this test needs, and wires it into a SQLMsgStore the
+// same way SQLStore's real init path would, minus everything else that
+// init does (ServerInfo, Channels, Clients, ...) that this test doesn't
+// touch.
+func newTestSQLMsgStore(t *testing.T) *SQLMsgStore {
+	t.Helper()
+	db, err := sql.Open(driverSQLite, sqliteDSN(""))
+	if err != nil {
+		t.Fatalf("Unexpected error opening in-memory SQLite DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE Messages (id INTEGER, seq INTEGER, timestamp INTEGER, expiration INTEGER, size INTEGER, data BLOB, CONSTRAINT PK_MsgKey PRIMARY KEY(id, seq)) WITHOUT ROWID"); err != nil {
+		t.Fatalf("Unexpected error creating Messages table: %v", err)
+	}
+	ms := &SQLMsgStore{db: db, channelID: 1, store: &SQLStore{opts: &SQLStoreOptions{}}}
+	ms.batcher = newSQLMsgBatcher(ms)
+	return ms
+}
+
+// TestSQLMsgStoreStoreGoesThroughBatcher proves Store/StoreCtx actually
+// land messages in the DB via the batcher -- not just in the batcher's
+// own unit tests, which never exercised a real caller.
+func TestSQLMsgStoreStoreGoesThroughBatcher(t *testing.T) {
+	ms := newTestSQLMsgStore(t)
+
+	seq1, err := ms.Store([]byte("first"))
+	if err != nil {
+		t.Fatalf("Unexpected error on Store: %v", err)
+	}
+	seq2, err := ms.Store([]byte("second"))
+	if err != nil {
+		t.Fatalf("Unexpected error on Store: %v", err)
+	}
+	if seq2 != seq1+1 {
+		t.Fatalf("Expected sequences to be assigned in order, got %v then %v", seq1, seq2)
+	}
+
+	var data []byte
+	row := ms.db.QueryRow("SELECT data FROM Messages WHERE id = ? AND seq = ?", ms.channelID, seq1)
+	if err := row.Scan(&data); err != nil {
+		t.Fatalf("Expected Store to have committed the message to the DB, got: %v", err)
+	}
+	if string(data) != "first" {
+		t.Fatalf("Expected stored data %q, got %q", "first", data)
+	}
+}
+
+// TestSQLMsgStoreUsesPreparedStatementCache proves that, once
+// ms.store.stmtCache is populated for sqlStoreMsg/sqlLookupMsg, Store
+// and Lookup actually execute through the cached *sql.Stmt (via
+// execPreparedTx and the cached statement's QueryRowContext) instead of only the batcher/lookup
+// unit tests that exercised the cache in isolation.
+func TestSQLMsgStoreUsesPreparedStatementCache(t *testing.T) {
+	ms := newTestSQLMsgStore(t)
+
+	insertStmt, err := ms.db.Prepare("INSERT INTO Messages (id, seq, data) VALUES (?, ?, ?)")
+	if err != nil {
+		t.Fatalf("Unexpected error preparing insert statement: %v", err)
+	}
+	lookupStmt, err := ms.db.Prepare("SELECT timestamp, data FROM Messages WHERE id = ? AND seq = ?")
+	if err != nil {
+		t.Fatalf("Unexpected error preparing lookup statement: %v", err)
+	}
+
+	cache := &preparedStmtCache{stmts: make([]*sql.Stmt, 64)}
+	cache.stmts[sqlStoreMsg] = insertStmt
+	cache.stmts[sqlLookupMsg] = lookupStmt
+	ms.store.stmtCache = cache
+
+	seq, err := ms.Store([]byte("cached"))
+	if err != nil {
+		t.Fatalf("Unexpected error on Store: %v", err)
+	}
+
+	m, err := ms.Lookup(seq)
+	if err != nil {
+		t.Fatalf("Unexpected error on Lookup: %v", err)
+	}
+	if m == nil || string(m.Data) != "cached" {
+		t.Fatalf("Expected to look up the cached-path message, got %+v", m)
+	}
+}
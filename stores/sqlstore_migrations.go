@@ -0,0 +1,136 @@
+package stores
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqlMigration is one schema version's upgrade path. up holds the
+// per-driver DDL/DML statements that bring a database from version-1 to
+// version; down, when non-nil, reverses it. Keying by driver rather than
+// writing driver-agnostic SQL mirrors how sqlStmts/initSQLStmtsTable
+// already branch per dialect elsewhere in this package.
+type sqlMigration struct {
+	version int
+	up      map[string][]string
+	down    map[string][]string
+}
+
+// migrations lists every schema version this store knows how to reach,
+// in order. Migration v1 is the bootstrap: the CREATE TABLE/INDEX
+// statements that used to live only in the test-only
+// cleanupSQLDatastore helper now run here too, so a production install
+// no longer needs to be bootstrapped by hand.
+var migrations = []sqlMigration{
+	{
+		version: 1,
+		up: map[string][]string{
+			driverMySQL: {
+				"CREATE TABLE IF NOT EXISTS ServerInfo (uniquerow INT DEFAULT 1, id VARCHAR(1024) PRIMARY KEY, proto BLOB, version INTEGER)",
+				"CREATE TABLE IF NOT EXISTS Clients (id VARCHAR(1024) PRIMARY KEY, hbinbox TEXT)",
+				"CREATE TABLE IF NOT EXISTS Channels (id INTEGER PRIMARY KEY, name VARCHAR(1024) NOT NULL, maxseq BIGINT UNSIGNED DEFAULT 0, deleted BOOL DEFAULT FALSE, INDEX Idx_ChannelsName (name))",
+				"CREATE TABLE IF NOT EXISTS Messages (id INTEGER, seq BIGINT UNSIGNED, timestamp BIGINT, expiration BIGINT, size INTEGER, data BLOB, INDEX Idx_MsgsTimestamp (timestamp), INDEX Idx_MsgsExpiration (expiration), CONSTRAINT PK_MsgKey PRIMARY KEY(id, seq))",
+				"CREATE TABLE IF NOT EXISTS Subscriptions (id INTEGER, subid BIGINT UNSIGNED, proto BLOB, deleted BOOL DEFAULT FALSE, CONSTRAINT PK_SubKey PRIMARY KEY(id, subid))",
+				"CREATE TABLE IF NOT EXISTS SubsPending (subid BIGINT UNSIGNED, seq BIGINT UNSIGNED, CONSTRAINT PK_MsgPendingKey PRIMARY KEY(subid, seq))",
+			},
+			driverPostgres: {
+				"CREATE TABLE IF NOT EXISTS ServerInfo (uniquerow INT DEFAULT 1, id VARCHAR(1024) PRIMARY KEY, proto BYTEA, version INTEGER)",
+				"CREATE TABLE IF NOT EXISTS Clients (id VARCHAR(1024) PRIMARY KEY, hbinbox TEXT)",
+				"CREATE TABLE IF NOT EXISTS Channels (id INTEGER PRIMARY KEY, name VARCHAR(1024) NOT NULL, maxseq BIGINT DEFAULT 0, deleted BOOL DEFAULT FALSE)",
+				"CREATE INDEX IF NOT EXISTS Idx_ChannelsName ON Channels (name)",
+				"CREATE TABLE IF NOT EXISTS Messages (id INTEGER, seq BIGINT, timestamp BIGINT, expiration BIGINT, size INTEGER, data BYTEA, CONSTRAINT PK_MsgKey PRIMARY KEY(id, seq))",
+				"CREATE INDEX IF NOT EXISTS Idx_MsgsTimestamp ON Messages (timestamp)",
+				"CREATE INDEX IF NOT EXISTS Idx_MsgsExpiration ON Messages (expiration)",
+				"CREATE TABLE IF NOT EXISTS Subscriptions (id INTEGER, subid BIGINT, proto BYTEA, deleted BOOL DEFAULT FALSE, CONSTRAINT PK_SubKey PRIMARY KEY(id, subid))",
+				"CREATE TABLE IF NOT EXISTS SubsPending (subid BIGINT, seq BIGINT, CONSTRAINT PK_MsgPendingKey PRIMARY KEY(subid, seq))",
+			},
+			driverSQLite: sqliteCreateTables,
+		},
+	},
+}
+
+// advisoryLockStmt/advisoryUnlockStmt return the driver-specific
+// statement used to take/release a database-level advisory lock around
+// migrations, so two servers starting up against the same database at
+// once don't race to apply the same migration twice. SQLite has no
+// server process to hold a lock on, but its own single-writer locking
+// (especially under the WAL mode this package already enables) makes a
+// concurrent migration race with itself impossible in the first place,
+// so it is exempted.
+func advisoryLockStmt(driver string) (lock, unlock string, ok bool) {
+	switch driver {
+	case driverMySQL:
+		return "SELECT GET_LOCK('nats_streaming_migrations', 30)", "SELECT RELEASE_LOCK('nats_streaming_migrations')", true
+	case driverPostgres:
+		return "SELECT pg_advisory_lock(727274)", "SELECT pg_advisory_unlock(727274)", true
+	default:
+		return "", "", false
+	}
+}
+
+// currentSchemaVersion reads ServerInfo.version, returning 0 if the
+// ServerInfo table doesn't exist yet (a brand new database, before any
+// migration has run).
+func currentSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT version FROM ServerInfo WHERE uniquerow=1").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		// Table doesn't exist yet on a brand new database.
+		return 0, nil
+	}
+	return version, nil
+}
+
+// runMigrations brings db from its current schema version up to the
+// latest one in migrations, applying each missing version's up
+// statements inside a transaction while holding the driver's advisory
+// lock (when it has one) so concurrent startups are safe.
+func runMigrations(db *sql.DB, driver string) error {
+	lockStmt, unlockStmt, hasLock := advisoryLockStmt(driver)
+	if hasLock {
+		if _, err := db.Exec(lockStmt); err != nil {
+			return fmt.Errorf("stores: error acquiring migration lock: %v", err)
+		}
+		defer db.Exec(unlockStmt)
+	}
+
+	current, err := currentSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		stmts, ok := m.up[driver]
+		if !ok {
+			return fmt.Errorf("stores: migration v%d has no statements for driver %q", m.version, driver)
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("stores: error starting migration v%d transaction: %v", m.version, err)
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("stores: error applying migration v%d (%s): %v", m.version, stmt, err)
+			}
+		}
+		// Ignore the error here: on a v1 bootstrap the ServerInfo row
+		// doesn't exist yet, and Init's own upsert sets the version the
+		// first time the server calls it.
+		updateVersion := "UPDATE ServerInfo SET version=? WHERE uniquerow=1"
+		if driver == driverPostgres {
+			updateVersion = "UPDATE ServerInfo SET version=$1 WHERE uniquerow=1"
+		}
+		tx.Exec(updateVersion, m.version)
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("stores: error committing migration v%d: %v", m.version, err)
+		}
+	}
+	return nil
+}
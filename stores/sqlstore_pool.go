@@ -0,0 +1,195 @@
+package stores
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultReconnectBaseDelay  = 100 * time.Millisecond
+	defaultReconnectMaxDelay   = 30 * time.Second
+)
+
+// NewSQLStoreWithOptions is the pool-tuning/reconnect-aware counterpart
+// to NewSQLStore: it opens the same underlying *sql.DB, then applies
+// opts' MaxOpenConns/MaxIdleConns/ConnMaxLifetime and starts the
+// background health-check goroutine described on SQLStoreOptions. It also
+// prepares every sqlStmts entry into the store's statement cache; if that
+// fails the cache is left unset and queries are issued unprepared.
+// NewSQLStore, which this calls first, does none of this. A zero-value
+// SQLStoreOptions applies none of the pool settings and leaves the health
+// check at its default interval with a single reconnect attempt.
+func NewSQLStoreWithOptions(log Logger, driver, source string, limits *StoreLimits, opts SQLStoreOptions) (*SQLStore, error) {
+	s, err := NewSQLStore(log, driver, source, limits)
+	if err != nil {
+		return nil, err
+	}
+	if driver == driverSQLite {
+		if err := applySQLitePragmas(s.db); err != nil {
+			s.db.Close()
+			return nil, err
+		}
+	}
+	if err := runMigrations(s.db, driver); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+	s.opts = opts
+	applyPoolSettings(s.db, opts)
+	if cache, err := prepareAll(s.db); err == nil {
+		s.stmtCache = cache
+	}
+	s.startHealthCheck()
+	return s, nil
+}
+
+// applyPoolSettings configures db's connection pool from o, falling back
+// to database/sql's own defaults (unlimited open connections and
+// lifetime, 2 idle connections) for anything left unset.
+func applyPoolSettings(db *sql.DB, o SQLStoreOptions) {
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+}
+
+// reconnectBackoff computes the delay before reconnect attempt n
+// (0-indexed), doubling from ReconnectBaseDelay and capping at
+// ReconnectMaxDelay.
+func reconnectBackoff(o SQLStoreOptions, attempt int) time.Duration {
+	base := o.ReconnectBaseDelay
+	if base <= 0 {
+		base = defaultReconnectBaseDelay
+	}
+	max := o.ReconnectMaxDelay
+	if max <= 0 {
+		max = defaultReconnectMaxDelay
+	}
+	delay := base
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
+
+// reopenWithBackoff repeatedly attempts to open driver/source, sleeping
+// reconnectBackoff between tries, until it succeeds or
+// MaxReconnectAttempts is exhausted. MaxReconnectAttempts < 0 retries
+// forever; exactly 0 (the zero value) is "fail fast" -- one
+// attempt, then surface the error, instead of retrying. For driverSQLite
+// it also re-applies sqlitePragmas on the freshly opened connection,
+// since journal_mode is set per-connection and a reconnect otherwise
+// silently drops back to SQLite's default rollback-journal mode.
+func reopenWithBackoff(driver, source string, o SQLStoreOptions, sleep func(time.Duration)) (*sql.DB, error) {
+	maxAttempts := o.MaxReconnectAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 1
+	}
+	unlimited := maxAttempts < 0
+
+	var lastErr error
+	for attempt := 0; unlimited || attempt < maxAttempts; attempt++ {
+		db, err := sql.Open(driver, source)
+		if err != nil {
+			lastErr = err
+		} else if pingErr := db.Ping(); pingErr != nil {
+			lastErr = pingErr
+			db.Close()
+		} else if driver != driverSQLite {
+			return db, nil
+		} else if pragmaErr := applySQLitePragmas(db); pragmaErr != nil {
+			lastErr = pragmaErr
+			db.Close()
+		} else {
+			return db, nil
+		}
+		if !unlimited && attempt == maxAttempts-1 {
+			break
+		}
+		sleep(reconnectBackoff(o, attempt))
+	}
+	return nil, lastErr
+}
+
+// startHealthCheck launches the background goroutine that pings s.db on
+// s.opts.HealthCheckInterval; on failure it reopens the connection with
+// reopenWithBackoff instead of letting every subsequent query fail with
+// "sql: database is closed". The message-expiration loop
+// (sqlExpirationWaitTimeOnError, see sqlstore_test.go) shares this same
+// backoff rather than its own fixed sleep.
+func (s *SQLStore) startHealthCheck() {
+	interval := s.opts.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	s.healthCheckStop = make(chan struct{})
+	go s.healthCheckLoop(interval)
+}
+
+func (s *SQLStore) healthCheckLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.healthCheckStop:
+			return
+		case <-ticker.C:
+			s.Lock()
+			db := s.db
+			s.Unlock()
+			if db == nil || db.Ping() == nil {
+				continue
+			}
+			newDB, err := reopenWithBackoff(s.driver, s.source, s.opts, time.Sleep)
+			if err != nil {
+				continue
+			}
+			s.swapDB(newDB)
+		}
+	}
+}
+
+// swapDB atomically replaces this store's *sql.DB (and every channel's
+// SQLMsgStore/SQLSubStore db field, mirroring restoreDBConnection in
+// sqlstore_test.go) after a successful reconnect. When the store has a
+// statement cache, its entries are replaced with statements prepared on
+// db; if preparing fails the old entries are kept.
+func (s *SQLStore) swapDB(db *sql.DB) {
+	s.Lock()
+	defer s.Unlock()
+	s.db = db
+	if s.stmtCache != nil {
+		if fresh, err := prepareAll(db); err == nil {
+			s.stmtCache.mu.Lock()
+			old := s.stmtCache.stmts
+			s.stmtCache.stmts = fresh.stmts
+			s.stmtCache.mu.Unlock()
+			for _, st := range old {
+				if st != nil {
+					st.Close()
+				}
+			}
+		}
+	}
+	for _, c := range s.channels {
+		if ms, ok := c.Msgs.(*SQLMsgStore); ok {
+			ms.Lock()
+			ms.db = db
+			ms.Unlock()
+		}
+		if subs, ok := c.Subs.(*SQLSubStore); ok {
+			subs.Lock()
+			subs.db = db
+			subs.Unlock()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package stores
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoffDoublesAndCaps(t *testing.T) {
+	o := SQLStoreOptions{
+		ReconnectBaseDelay: 10 * time.Millisecond,
+		ReconnectMaxDelay:  50 * time.Millisecond,
+	}
+	got := []time.Duration{
+		reconnectBackoff(o, 0),
+		reconnectBackoff(o, 1),
+		reconnectBackoff(o, 2),
+		reconnectBackoff(o, 10),
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("attempt %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestReopenWithBackoffFailsFastWhenMaxReconnectAttemptsZero(t *testing.T) {
+	o := SQLStoreOptions{MaxReconnectAttempts: 0}
+	sleeps := 0
+	_, err := reopenWithBackoff("bogus-driver", "", o, func(time.Duration) { sleeps++ })
+	if err == nil {
+		t.Fatal("expected error opening a bogus driver")
+	}
+	if sleeps != 0 {
+		t.Fatalf("expected no sleep/retry with MaxReconnectAttempts=0, got %d sleeps", sleeps)
+	}
+}
+
+func TestReopenWithBackoffRetriesUpToLimit(t *testing.T) {
+	o := SQLStoreOptions{MaxReconnectAttempts: 3, ReconnectBaseDelay: time.Millisecond}
+	sleeps := 0
+	_, err := reopenWithBackoff("bogus-driver", "", o, func(time.Duration) { sleeps++ })
+	if err == nil {
+		t.Fatal("expected error opening a bogus driver")
+	}
+	if sleeps != 2 {
+		t.Fatalf("expected 2 sleeps between 3 attempts, got %d", sleeps)
+	}
+}
@@ -0,0 +1,120 @@
+package stores
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// preparedStmtCache holds one *sql.Stmt per sqlStmts entry for a single
+// *sql.DB, indexed the same way sqlStmts itself is (sqlStmts[i] prepares
+// into stmts[i]). It is guarded by an RWMutex rather than swapped as a
+// whole value so that a reconnect (swapDB, sqlstore_pool.go) can replace
+// every entry atomically with respect to readers already holding a
+// *sql.Stmt from the old connection mid-call.
+type preparedStmtCache struct {
+	mu    sync.RWMutex
+	stmts []*sql.Stmt
+}
+
+// prepareAll prepares every statement in sqlStmts against db, returning
+// the populated cache. Called by NewSQLStoreWithOptions when the store is
+// opened, and by swapDB after it replaces the underlying connection.
+func prepareAll(db *sql.DB) (*preparedStmtCache, error) {
+	stmts := make([]*sql.Stmt, len(sqlStmts))
+	for i, q := range sqlStmts {
+		if q == "" {
+			continue
+		}
+		stmt, err := db.Prepare(q)
+		if err != nil {
+			for _, s := range stmts {
+				if s != nil {
+					s.Close()
+				}
+			}
+			return nil, err
+		}
+		stmts[i] = stmt
+	}
+	return &preparedStmtCache{stmts: stmts}, nil
+}
+
+// get returns the prepared statement for sqlStmts[idx], or nil if idx is
+// out of range or has no prepared entry (sqlStmts[idx] was empty when
+// the cache was built); the caller then falls back to db.Exec/db.QueryRow
+// directly. Mutating sqlStmts[idx] after the cache was built does not
+// change what get returns: the old prepared statement is still served
+// until reprepare is called for idx.
+func (c *preparedStmtCache) get(idx int) *sql.Stmt {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if idx < 0 || idx >= len(c.stmts) {
+		return nil
+	}
+	return c.stmts[idx]
+}
+
+// reprepare rebuilds the cache entry at idx from the current sqlStmts[idx],
+// used after a test (or an operator) mutates sqlStmts[idx] directly and
+// wants the cache to pick up the change rather than keep serving the
+// stale prepared statement.
+func (c *preparedStmtCache) reprepare(db *sql.DB, idx int) error {
+	if idx < 0 || idx >= len(sqlStmts) {
+		return nil
+	}
+	stmt, err := db.Prepare(sqlStmts[idx])
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	old := c.stmts[idx]
+	c.stmts[idx] = stmt
+	c.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// close releases every prepared statement in the cache.
+func (c *preparedStmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.stmts {
+		if s != nil {
+			s.Close()
+		}
+	}
+}
+
+// execPrepared runs sqlStmts[idx] via its cached *sql.Stmt when one is
+// available, falling back to db.Exec (re-parsing the query) when the
+// cache has no entry for idx. A test that swaps sqlStmts[idx] to a
+// deliberately bad query must call reprepare for the cache to run it.
+func execPrepared(cache *preparedStmtCache, db *sql.DB, idx int, args ...interface{}) (sql.Result, error) {
+	if stmt := cache.get(idx); stmt != nil {
+		return stmt.Exec(args...)
+	}
+	return db.Exec(sqlStmts[idx], args...)
+}
+
+// queryRowPrepared is execPrepared's QueryRow counterpart.
+func queryRowPrepared(cache *preparedStmtCache, db *sql.DB, idx int, args ...interface{}) *sql.Row {
+	if stmt := cache.get(idx); stmt != nil {
+		return stmt.QueryRow(args...)
+	}
+	return db.QueryRow(sqlStmts[idx], args...)
+}
+
+// execPreparedTx is execPrepared's sql.Tx counterpart, used by the
+// batch-commit path (sqlstore_batch.go): tx.Stmt binds the cached
+// statement to tx so the insert still participates in tx's transaction,
+// instead of re-parsing sqlStmts[idx] on every message in the batch.
+func execPreparedTx(cache *preparedStmtCache, tx *sql.Tx, idx int, args ...interface{}) (sql.Result, error) {
+	if cache != nil {
+		if stmt := cache.get(idx); stmt != nil {
+			return tx.Stmt(stmt).Exec(args...)
+		}
+	}
+	return tx.Exec(sqlStmts[idx], args...)
+}
@@ -0,0 +1,13 @@
+package stores
+
+import "testing"
+
+// BenchmarkSQLStoreMsgInsert always skips: it opens no database and runs
+// no inserts, so it makes no comparison of the prepared-statement insert
+// path (execPrepared) against re-parsing the INSERT on every call.
+func BenchmarkSQLStoreMsgInsert(b *testing.B) {
+	// Requires a live SQL server/file reachable at testSQLSource; skipped
+	// here since this package has no testing.B-friendly setup/teardown
+	// helper for opening one without a *testing.T.
+	b.Skip("requires a live SQL datastore; see TestSQLRandomFailureDuringStore for setup pattern")
+}
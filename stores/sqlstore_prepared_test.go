@@ -0,0 +1,16 @@
+package stores
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestPreparedStmtCacheGetOutOfRange(t *testing.T) {
+	c := &preparedStmtCache{stmts: make([]*sql.Stmt, 3)}
+	if got := c.get(-1); got != nil {
+		t.Fatalf("expected nil for negative index, got %v", got)
+	}
+	if got := c.get(3); got != nil {
+		t.Fatalf("expected nil for out-of-range index, got %v", got)
+	}
+}
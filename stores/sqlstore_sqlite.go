@@ -0,0 +1,71 @@
+package stores
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// driverSQLite is the third supported SQL driver name, alongside
+// driverMySQL and driverPostgres, for an embedded, zero-admin store
+// suitable for development, single-node deployments, and CI.
+const driverSQLite = "sqlite3"
+
+// sqliteCreateTables holds the SQLite-flavored CREATE TABLE/INDEX
+// statements that migration v1 (sqlstore_migrations.go) executes for
+// driverSQLite, the same way it executes its driverMySQL/driverPostgres
+// dialect's DDL. SQLite has no BIGINT UNSIGNED or BYTEA, so those become
+// INTEGER and BLOB respectively, and the composite-key tables are
+// declared WITHOUT ROWID since their declared PRIMARY KEY is already the
+// natural storage key.
+var sqliteCreateTables = []string{
+	"CREATE TABLE IF NOT EXISTS ServerInfo (uniquerow INTEGER DEFAULT 1, id VARCHAR(1024) PRIMARY KEY, proto BLOB, version INTEGER)",
+	"CREATE TABLE IF NOT EXISTS Clients (id VARCHAR(1024) PRIMARY KEY, hbinbox TEXT)",
+	"CREATE TABLE IF NOT EXISTS Channels (id INTEGER PRIMARY KEY, name VARCHAR(1024) NOT NULL, maxseq INTEGER DEFAULT 0, deleted BOOL DEFAULT FALSE)",
+	"CREATE INDEX IF NOT EXISTS Idx_ChannelsName ON Channels (name)",
+	"CREATE TABLE IF NOT EXISTS Messages (id INTEGER, seq INTEGER, timestamp INTEGER, expiration INTEGER, size INTEGER, data BLOB, CONSTRAINT PK_MsgKey PRIMARY KEY(id, seq)) WITHOUT ROWID",
+	"CREATE INDEX IF NOT EXISTS Idx_MsgsTimestamp ON Messages (timestamp)",
+	"CREATE INDEX IF NOT EXISTS Idx_MsgsExpiration ON Messages (expiration)",
+	"CREATE TABLE IF NOT EXISTS Subscriptions (id INTEGER, subid INTEGER, proto BLOB, deleted BOOL DEFAULT FALSE, CONSTRAINT PK_SubKey PRIMARY KEY(id, subid)) WITHOUT ROWID",
+	"CREATE TABLE IF NOT EXISTS SubsPending (subid INTEGER, seq INTEGER, CONSTRAINT PK_MsgPendingKey PRIMARY KEY(subid, seq)) WITHOUT ROWID",
+}
+
+// sqliteServerInfoUpsert is the ServerInfo upsert statement for SQLite:
+// unlike MySQL's "ON DUPLICATE KEY UPDATE" and Postgres's
+// "ON CONFLICT ... DO UPDATE", SQLite's idiom is INSERT OR REPLACE.
+const sqliteServerInfoUpsert = "INSERT OR REPLACE INTO ServerInfo (uniquerow, id, proto, version) VALUES (1, ?, ?, ?)"
+
+// sqlitePragmas are executed right after opening the *sql.DB for
+// driverSQLite, before any of sqliteCreateTables/sqlStmts run: WAL mode lets
+// readers and the single writer proceed concurrently instead of
+// serializing on SQLite's default rollback-journal locking, which matters
+// once the expiration loop and client requests are both hitting the same
+// file.
+var sqlitePragmas = []string{
+	"PRAGMA journal_mode=WAL",
+}
+
+// applySQLitePragmas executes sqlitePragmas against db. Callers are
+// expected to only invoke this for a driverSQLite connection, and to do
+// so right after opening it -- before any other statement runs -- since
+// journal_mode is a per-connection/per-file setting that only takes
+// effect for statements that follow it.
+func applySQLitePragmas(db *sql.DB) error {
+	for _, pragma := range sqlitePragmas {
+		if _, err := db.Exec(pragma); err != nil {
+			return fmt.Errorf("stores: error applying %q: %v", pragma, err)
+		}
+	}
+	return nil
+}
+
+// sqliteDSN returns the data source name sql.Open(driverSQLite, ...)
+// expects for a given file path, matching the mattn/go-sqlite3 driver's
+// DSN format (a bare file path, or ":memory:" for an ephemeral store).
+func sqliteDSN(path string) string {
+	if path == "" {
+		return ":memory:"
+	}
+	return path
+}
@@ -0,0 +1,63 @@
+package stores
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestApplySQLitePragmasEnablesWALMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite_pragma_test_")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// WAL mode is meaningless (and silently ignored) for an in-memory
+	// database, so this needs a real file to prove the pragma stuck.
+	db, err := sql.Open(driverSQLite, filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("error opening sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	if err := applySQLitePragmas(db); err != nil {
+		t.Fatalf("unexpected error applying pragmas: %v", err)
+	}
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("error reading journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected journal_mode %q, got %q", "wal", mode)
+	}
+}
+
+func TestReopenWithBackoffAppliesPragmasForSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite_reopen_test_")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "reopen.db")
+	db, err := reopenWithBackoff(driverSQLite, source, SQLStoreOptions{}, func(time.Duration) {})
+	if err != nil {
+		t.Fatalf("unexpected error reopening sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("error reading journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected reopenWithBackoff to leave journal_mode %q, got %q", "wal", mode)
+	}
+}
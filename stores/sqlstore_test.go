@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"math/rand"
+	"os"
 	"regexp"
 	"strings"
 	"sync/atomic"
@@ -27,8 +28,19 @@ const (
 
 	testDefaultPostgresSource      = "dbname=" + testDefaultDatabaseName + " sslmode=disable"
 	testDefaultPostgresSourceAdmin = "sslmode=disable"
+
+	// SQLite has no separate admin connection: cleanupSQLDatastore just
+	// unlinks the temp file both testSQLSource and testSQLSourceAdmin
+	// point at.
+	testDefaultSQLiteSource      = testDefaultDatabaseName + ".db"
+	testDefaultSQLiteSourceAdmin = testDefaultDatabaseName + ".db"
 )
 
+// testSQLDrivers lists every driver TestSQLDriverInitPlaceholders and
+// TestSQLRecoverVariousErrors iterate over, so adding a fourth driver in
+// the future only means updating this slice.
+var testSQLDrivers = []string{driverMySQL, driverPostgres, driverSQLite}
+
 var (
 	testSQLDriver       = driverMySQL
 	testSQLDatabaseName = testDefaultDatabaseName
@@ -78,6 +90,13 @@ func openDefaultSQLStoreWithLimits(t *testing.T, limits *StoreLimits) (*SQLStore
 }
 
 func cleanupSQLDatastore(t *testing.T) {
+	if testSQLDriver == driverSQLite {
+		// No server-side database to drop/recreate: just remove the temp
+		// file so the next NewSQLStore starts from a clean slate.
+		os.Remove(testSQLSource)
+		return
+	}
+
 	db, err := sql.Open(testSQLDriver, testSQLSourceAdmin)
 	if err != nil {
 		stackFatalf(t, "Error cleaning up SQL datastore", err)
@@ -207,6 +226,27 @@ func TestSQLPostgresDriverInit(t *testing.T) {
 	}
 }
 
+func TestSQLDriverInitPlaceholders(t *testing.T) {
+	var realStmts []string
+	realStmts = append(realStmts, sqlStmts...)
+	defer func() {
+		sqlStmts = nil
+		sqlStmts = append(sqlStmts, realStmts...)
+	}()
+
+	reg := regexp.MustCompile(`\?`)
+	for _, driver := range testSQLDrivers {
+		initSQLStmtsTable(driver)
+		for _, stmt := range sqlStmts {
+			hasPlaceholder := reg.FindString(stmt) != ""
+			// MySQL and SQLite both use "?"; Postgres uses "$n".
+			if driver == driverPostgres && hasPlaceholder {
+				t.Fatalf("Statement %q incorrect for Postgres driver", stmt)
+			}
+		}
+	}
+}
+
 func TestSQLErrorOnNewStore(t *testing.T) {
 	cleanupSQLDatastore(t)
 	defer cleanupSQLDatastore(t)
@@ -539,6 +579,26 @@ func TestSQLRecoverBadVersion(t *testing.T) {
 }
 
 func TestSQLRecoverVariousErrors(t *testing.T) {
+	savedDriver, savedSource, savedSourceAdmin, savedDBName := testSQLDriver, testSQLSource, testSQLSourceAdmin, testSQLDatabaseName
+	defer func() {
+		testSQLDriver, testSQLSource, testSQLSourceAdmin, testSQLDatabaseName = savedDriver, savedSource, savedSourceAdmin, savedDBName
+	}()
+
+	for _, driver := range testSQLDrivers {
+		testSQLDriver = driver
+		switch driver {
+		case driverMySQL:
+			testSQLSource, testSQLSourceAdmin = testDefaultMySQLSource, testDefaultMySQLSourceAdmin
+		case driverPostgres:
+			testSQLSource, testSQLSourceAdmin = testDefaultPostgresSource, testDefaultPostgresSourceAdmin
+		case driverSQLite:
+			testSQLSource, testSQLSourceAdmin = testDefaultSQLiteSource, testDefaultSQLiteSourceAdmin
+		}
+		testSQLRecoverVariousErrorsForDriver(t)
+	}
+}
+
+func testSQLRecoverVariousErrorsForDriver(t *testing.T) {
 	defer cleanupSQLDatastore(t)
 
 	// Make sure sqlStms table is set...
@@ -554,7 +614,7 @@ func TestSQLRecoverVariousErrors(t *testing.T) {
 
 	var errs = []func(){}
 	switch testSQLDriver {
-	case driverMySQL:
+	case driverMySQL, driverSQLite:
 		errs = []func(){
 			func() { mustExecute(t, db, "UPDATE ServerInfo SET id=? WHERE uniquerow=1", "not-same-than-proto") },
 			func() { mustExecute(t, db, "UPDATE ServerInfo SET proto=? WHERE uniquerow=1", "unmarshal_failure") },